@@ -0,0 +1,100 @@
+package lexer
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonToken is the JSON form of a Token. Type holds the registered name
+// of the token type as a string, or the type's number if it has none.
+type jsonToken struct {
+	Type json.RawMessage `json:"type"`
+	Val  string          `json:"val"`
+	Pos  int             `json:"pos"`
+	End  int             `json:"end"`
+}
+
+// MarshalJSON encodes the token as an object such as
+// {"type":"IDENT","val":"foo","pos":12,"end":15}, using the name
+// registered for the token type, or its number if none is registered.
+func (i Token) MarshalJSON() ([]byte, error) {
+	var typ []byte
+	var err error
+	if name, ok := lookupTokenName(i.Typ); ok {
+		typ, err = json.Marshal(name)
+	} else {
+		typ, err = json.Marshal(int(i.Typ))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonToken{Type: typ, Val: i.Val, Pos: i.Pos, End: i.End})
+}
+
+// UnmarshalJSON decodes a token encoded by MarshalJSON. A type given by
+// name must have been registered with RegisterTokenName.
+func (i *Token) UnmarshalJSON(data []byte) error {
+	var jt jsonToken
+	if err := json.Unmarshal(data, &jt); err != nil {
+		return err
+	}
+	var typ TokenType
+	var name string
+	if err := json.Unmarshal(jt.Type, &name); err == nil {
+		t, ok := lookupTokenType(name)
+		if !ok {
+			return fmt.Errorf("lexer: unknown token type %q", name)
+		}
+		typ = t
+	} else if err := json.Unmarshal(jt.Type, &typ); err != nil {
+		return fmt.Errorf("lexer: invalid token type %s", jt.Type)
+	}
+	*i = Token{Typ: typ, Val: jt.Val, Pos: jt.Pos, End: jt.End}
+	return nil
+}
+
+// gobToken is the form in which EncodeTokens stores a Token.
+type gobToken struct {
+	Name string // registered name of the type, if any
+	Type int    // number of the type, used when Name is empty or unknown
+	Val  string
+	Pos  int
+	End  int
+}
+
+// EncodeTokens writes toks to w in gob format. Each token's type is
+// recorded both by its registered name, if it has one, and by number.
+//
+// DecodeTokens resolves a recorded name back to whatever type that
+// name is registered for when decoding, falling back to the recorded
+// number only for types that had no name or whose name is no longer
+// registered. A stream written by one build of a program therefore
+// decodes correctly in another in which the token constants have been
+// renumbered, provided they are registered under the same names.
+func EncodeTokens(w io.Writer, toks []Token) error {
+	gts := make([]gobToken, len(toks))
+	for i, t := range toks {
+		name, _ := lookupTokenName(t.Typ)
+		gts[i] = gobToken{Name: name, Type: int(t.Typ), Val: t.Val, Pos: t.Pos, End: t.End}
+	}
+	return gob.NewEncoder(w).Encode(gts)
+}
+
+// DecodeTokens reads tokens written by EncodeTokens from r.
+func DecodeTokens(r io.Reader) ([]Token, error) {
+	var gts []gobToken
+	if err := gob.NewDecoder(r).Decode(&gts); err != nil {
+		return nil, err
+	}
+	toks := make([]Token, len(gts))
+	for i, gt := range gts {
+		typ, ok := lookupTokenType(gt.Name)
+		if gt.Name == "" || !ok {
+			typ = TokenType(gt.Type)
+		}
+		toks[i] = Token{Typ: typ, Val: gt.Val, Pos: gt.Pos, End: gt.End}
+	}
+	return toks, nil
+}
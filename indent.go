@@ -0,0 +1,108 @@
+package lexer
+
+import "strings"
+
+// indentation tracks the leading white space of lines for lexers
+// created with WithIndentation.
+type indentation struct {
+	indent, dedent TokenType
+	levels         []string // leading white space of each open level
+	checked        int      // offset of the last line start examined
+}
+
+// WithIndentation makes the lexer track indentation, as in Python or
+// YAML. At the start of each line that is not blank, the leading spaces
+// and tabs are compared with those of the enclosing lines: a deeper
+// indentation produces an indent token holding the new white space,
+// and a shallower one produces a zero-width dedent token for each
+// level closed. Any levels still open at the end of the input are
+// closed by dedent tokens just before the TokenEOF. Indentation is
+// examined between calls to state functions, so a state function that
+// consumes a line break should return rather than go on to lex the
+// next line itself.
+//
+// Indentation is compared textually, so a line must begin with the
+// exact white space of the level it returns to, or extend that of the
+// current level. Anything else, such as mixing tabs and spaces
+// inconsistently, stops the lexer with a TokenError.
+func WithIndentation(indent, dedent TokenType) Option {
+	return func(l *Lexer) {
+		l.indent = &indentation{indent: indent, dedent: dedent}
+		l.indent.reset()
+	}
+}
+
+func (in *indentation) reset() {
+	in.levels = []string{""}
+	in.checked = -1
+}
+
+// lineStart processes the indentation of the line beginning at Pos, if
+// Pos is the start of a line not yet examined, no token is pending and
+// the line does not continue a bracketed expression.
+// It reports false if the indentation is inconsistent, in which case an
+// error token has been emitted.
+func (in *indentation) lineStart(l *Lexer) bool {
+	if l.Start != l.Pos || l.base+l.Pos == in.checked || !l.atLineStart() || l.nl.bracketed() {
+		return true
+	}
+	in.checked = l.base + l.Pos
+	l.AcceptRun(" \t")
+	ws := l.Current()
+	if r := l.Peek(); r == '\n' || r == '\r' || r == EOF {
+		// Blank lines do not affect indentation.
+		l.Ignore()
+		return true
+	}
+	top := in.levels[len(in.levels)-1]
+	switch {
+	case ws == top:
+		l.Ignore()
+	case strings.HasPrefix(ws, top):
+		in.levels = append(in.levels, ws)
+		l.Emit(in.indent)
+	default:
+		n := 0
+		for ws != top {
+			if strings.HasPrefix(ws, top) {
+				l.Errorf("unindent does not match any outer indentation level")
+				return false
+			}
+			if !strings.HasPrefix(top, ws) {
+				l.Errorf("inconsistent use of tabs and spaces in indentation")
+				return false
+			}
+			in.levels = in.levels[:len(in.levels)-1]
+			top = in.levels[len(in.levels)-1]
+			n++
+		}
+		l.Ignore()
+		for ; n > 0; n-- {
+			l.EmitValue(in.dedent, "")
+		}
+	}
+	return true
+}
+
+// dedentAll emits a dedent token for each open level.
+func (in *indentation) dedentAll(l *Lexer) {
+	for len(in.levels) > 1 {
+		in.levels = in.levels[:len(in.levels)-1]
+		l.EmitValue(in.dedent, "")
+	}
+}
+
+// atLineStart reports whether Pos is at the start of a line.
+func (l *Lexer) atLineStart() bool {
+	if l.Pos == 0 {
+		return true
+	}
+	switch l.Input[l.Pos-1] {
+	case '\n':
+		return true
+	case '\r':
+		l.ensure(1)
+		return l.Pos == len(l.Input) || l.Input[l.Pos] != '\n'
+	}
+	return false
+}
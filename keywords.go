@@ -0,0 +1,90 @@
+package lexer
+
+import "unicode/utf8"
+
+// Keywords matches the input against a fixed set of keywords in a
+// single pass, however many there are. The zero value matches nothing;
+// use NewKeywords to build one.
+type Keywords struct {
+	root   *kwNode
+	maxLen int // length in bytes of the longest keyword
+}
+
+// kwNode is a node of the byte trie held by Keywords.
+type kwNode struct {
+	next map[byte]*kwNode
+	typ  TokenType
+	word bool // whether a keyword ends here
+}
+
+// NewKeywords returns a Keywords matching each key of words as the
+// corresponding token type. Empty keys are ignored.
+func NewKeywords(words map[string]TokenType) Keywords {
+	k := Keywords{root: &kwNode{}}
+	for w, t := range words {
+		if w == "" {
+			continue
+		}
+		n := k.root
+		for i := 0; i < len(w); i++ {
+			c, ok := n.next[w[i]]
+			if !ok {
+				if n.next == nil {
+					n.next = make(map[byte]*kwNode)
+				}
+				c = &kwNode{}
+				n.next[w[i]] = c
+			}
+			n = c
+		}
+		n.typ, n.word = t, true
+		k.maxLen = max(k.maxLen, len(w))
+	}
+	return k
+}
+
+// Match consumes the longest keyword at Pos and returns its type,
+// reporting whether one was found; if none was, nothing is consumed. A
+// keyword ending in an identifier rune matches only if the input does
+// not continue with another one, as judged by the predicate set with
+// WithIdentContinue (IsIdentContinue by default), so neither "in" nor
+// "int" is found at the start of "interface".
+func (k Keywords) Match(l *Lexer) (TokenType, bool) {
+	if k.root == nil {
+		return 0, false
+	}
+	l.ensure(k.maxLen + utf8.UTFMax)
+	in := l.Input[l.Pos:]
+	var typ TokenType
+	end := -1
+	n := k.root
+	for i := 0; i < len(in); i++ {
+		if n = n.next[in[i]]; n == nil {
+			break
+		}
+		if n.word && wordEnd(in, i+1, l.isIdentContinue) {
+			typ, end = n.typ, i+1
+		}
+	}
+	if end < 0 {
+		return 0, false
+	}
+	for stop := l.Pos + end; l.Pos < stop; {
+		if l.Next() == EOF {
+			break // the lexer has stopped
+		}
+	}
+	return typ, true
+}
+
+// wordEnd reports whether a keyword may end at s[i], that is, whether
+// the runes either side of i are not both identifier runes as judged
+// by isIdent.
+func wordEnd(s string, i int, isIdent func(rune) bool) bool {
+	if i >= len(s) {
+		return true
+	}
+	last, _ := utf8.DecodeLastRuneInString(s[:i])
+	next, _ := utf8.DecodeRuneInString(s[i:])
+	return !isIdent(last) || !isIdent(next)
+}
@@ -5,9 +5,21 @@
 package lexer
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
 	"unicode/utf8"
+	"unsafe"
 )
 
 // TokenType identifies the type used to represent lexical tokens.
@@ -23,10 +35,121 @@ type Token struct {
 	Typ TokenType // Type, such as itemNumber
 	Val string    // Value, such as "23.2"
 	Pos int       // location of token in input
+	End int       // location just past the token's source text
+
+	// Payload holds a semantic value computed by the state function
+	// that emitted the token, such as a decoded number; see EmitPayload.
+	// It is nil for tokens from Emit and is not encoded by MarshalJSON
+	// or EncodeTokens.
+	Payload any
+
+	// Attr holds metadata describing the token, such as a hint that a
+	// number was written in hex; see EmitWithAttr. It is nil for tokens
+	// from Emit and, like Payload, is not encoded.
+	Attr any
+
+	err *LexError // details of a TokenError produced by Errorf
+	off int       // byte offset of the token when Pos counts runes
+}
+
+// LexError describes a lexical error and where in the input it occurred.
+type LexError struct {
+	Name   string // name of the input
+	Msg    string // text of the error
+	Pos    int    // byte offset of the error in the input
+	Line   int    // 1-based line number of Pos
+	Column int    // 1-based column of Pos, counted in runes
+	Err    error  // kind of error, such as ErrInvalidUTF8; nil if unclassified
+}
+
+// Errors identifying the kind of a LexError reported by the lexer or
+// its scanning helpers, for use with errors.Is.
+var (
+	ErrUnexpectedEOF       = errors.New("lexer: unexpected EOF")
+	ErrUnterminatedString  = errors.New("lexer: unterminated string")
+	ErrUnterminatedComment = errors.New("lexer: unterminated comment")
+	ErrInvalidEscape       = errors.New("lexer: invalid escape sequence")
+	ErrInvalidUTF8         = errors.New("lexer: invalid UTF-8 encoding")
+	ErrTokenTooLarge       = errors.New("lexer: token too large")
+)
+
+// Error formats the error as "name:line:col: msg", omitting the name
+// if it is empty.
+func (e LexError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.Name, e.Line, e.Column, e.Msg)
+}
+
+// Unwrap returns e.Err, so that errors.Is(e, ErrInvalidUTF8), say,
+// reports whether e is an error of that kind.
+func (e LexError) Unwrap() error {
+	return e.Err
+}
+
+// LexError returns the error details carried by a TokenError produced
+// by Errorf or EmitErrorf. It reports false for any other token.
+func (i Token) LexError() (LexError, bool) {
+	if i.Typ != TokenError || i.err == nil {
+		return LexError{}, false
+	}
+	return *i.err, true
 }
 
 const EOF = -1 // Rune returned to indicate EOF
 
+// maxBackup is the number of consumed runes that Backup can step back over.
+const maxBackup = 16
+
+// history is a small stack of the widths of recently consumed runes.
+// When full, the oldest width is discarded. Reads at EOF are recorded
+// as a width of 0; successive ones are counted rather than stored, so
+// that they cannot push the widths of real runes out of the stack.
+type history struct {
+	widths [maxBackup]uint8
+	head   int // index of the next push, modulo maxBackup
+	n      int // number of widths held
+	eofs   int // further EOF reads above a 0 at the top
+}
+
+func (h *history) push(w int) {
+	if w == 0 && h.n > 0 && h.top() == 0 {
+		h.eofs++
+		return
+	}
+	h.widths[h.head%maxBackup] = uint8(w)
+	h.head++
+	if h.n < maxBackup {
+		h.n++
+	}
+}
+
+func (h *history) pop() (int, bool) {
+	if h.eofs > 0 {
+		h.eofs--
+		return 0, true
+	}
+	if h.n == 0 {
+		return 0, false
+	}
+	h.head--
+	h.n--
+	return int(h.widths[h.head%maxBackup]), true
+}
+
+// top returns the most recently pushed width, or 0 if h is empty.
+func (h *history) top() int {
+	if h.n == 0 {
+		return 0
+	}
+	return int(h.widths[(h.head-1)%maxBackup])
+}
+
+func (h *history) reset() {
+	*h = history{}
+}
+
 func (i Token) String() string {
 	switch i.Typ {
 	case TokenEOF:
@@ -34,10 +157,76 @@ func (i Token) String() string {
 	case TokenError:
 		return i.Val
 	}
+	var val string
 	if len(i.Val) > 10 {
-		return fmt.Sprintf("%.10q...", i.Val)
+		val = fmt.Sprintf("%.10q...", i.Val)
+	} else {
+		val = fmt.Sprintf("%q", i.Val)
+	}
+	if name, ok := lookupTokenName(i.Typ); ok {
+		return name + "(" + val + ")"
+	}
+	return val
+}
+
+// StringWithPos returns the token rendered as by String followed by
+// its offset, Pos, as in IDENT("foo")@12; the offset counts runes
+// rather than bytes for a lexer using WithRuneOffsets. Lexer.Describe
+// gives the line and column instead.
+func (i Token) StringWithPos() string {
+	return fmt.Sprintf("%s@%d", i, i.Pos)
+}
+
+// Len returns the length in bytes of the token's value. For tokens
+// emitted with a normalized value, such as by EmitValue, this may
+// differ from the length of the source text, End - Pos.
+func (i Token) Len() int {
+	return len(i.Val)
+}
+
+var tokenNames = struct {
+	sync.RWMutex
+	m map[TokenType]string
+}{m: map[TokenType]string{
+	TokenError: "ERROR",
+	TokenEOF:   "EOF",
+}}
+
+// RegisterTokenName associates a human-readable name with a token
+// type. The name is used by TokenName and Token.String. It is safe to
+// call RegisterTokenName from multiple goroutines.
+func RegisterTokenName(t TokenType, name string) {
+	tokenNames.Lock()
+	tokenNames.m[t] = name
+	tokenNames.Unlock()
+}
+
+// TokenName returns the name registered for t, or "TokenType(n)" if
+// no name has been registered.
+func TokenName(t TokenType) string {
+	if name, ok := lookupTokenName(t); ok {
+		return name
 	}
-	return fmt.Sprintf("%q", i.Val)
+	return "TokenType(" + strconv.Itoa(int(t)) + ")"
+}
+
+func lookupTokenName(t TokenType) (string, bool) {
+	tokenNames.RLock()
+	defer tokenNames.RUnlock()
+	name, ok := tokenNames.m[t]
+	return name, ok
+}
+
+// lookupTokenType returns the token type registered with name.
+func lookupTokenType(name string) (TokenType, bool) {
+	tokenNames.RLock()
+	defer tokenNames.RUnlock()
+	for t, n := range tokenNames.m {
+		if n == name {
+			return t, true
+		}
+	}
+	return 0, false
 }
 
 // StateFn represents the state of the scanner as a function that
@@ -46,91 +235,776 @@ type StateFn func(*Lexer) StateFn
 
 // lexer holds the state of the scanner.
 type Lexer struct {
-	name    string     // used only for error reports
-	Input   string     // the string being scanned
-	state   StateFn    // the next lexing function to enter
-	Start   int        // start position of this item
-	Pos     int        // current position in the input
-	lastPos int        // position of last token in input
-	Width   int        // width of last run from input
-	tokens  chan Token // channel of scanned tokens
+	name        string              // used only for error reports
+	Input       string              // the string being scanned
+	state       StateFn             // the next lexing function to enter
+	initial     StateFn             // the state lexing began in
+	states      []StateFn           // stack maintained by PushState and PopState
+	named       map[string]StateFn  // states registered by WithStates
+	Start       int                 // start position of this item
+	Pos         int                 // current position in the input
+	lastPos     int                 // position of last token in input
+	errs        []LexError          // errors reported so far
+	stopErr     *LexError           // terminal error in the last token sent, if it was one
+	ended       bool                // last token sent was a TokenEOF
+	onError     func(LexError)      // called for each error before its token is sent
+	posErrors   bool                // prefix error token values with name:line:col
+	strictUTF8  bool                // treat invalid UTF-8 as an error
+	stripBOM    bool                // skip a leading byte order mark
+	maxToken    int                 // longest pending token allowed, if positive
+	normalize   func(string) string // rewrites values of normTypes on emit
+	normTypes   map[TokenType]bool  // types normalized; nil for all
+	halted      bool                // stopped by fail; further tokens are dropped
+	last        Token               // last token returned by NextToken
+	final       *Token              // token repeated by NextToken once lexing has finished
+	pooled      bool                // obtained from GetLexer
+	Width       int                 // width of last run from input
+	hist        history             // widths of recently consumed runes
+	tokens      chan Token          // channel of scanned tokens; nil for a synchronous lexer
+	pending     []Token             // tokens emitted but not yet returned by a synchronous lexer
+	ahead       []Token             // tokens pushed back by PushBack or PeekToken
+	done        chan struct{}       // closed by Close to stop the run loop
+	ctx         context.Context     // cancels lexing when done
+	closing     sync.Once           // guards closing done
+	finished    chan struct{}       // closed once lexing has completed
+	launch      sync.Once           // starts the run goroutine on first use
+	running     bool                // whether the run goroutine has been started
+	mu          sync.RWMutex        // guards Input, base, lines, lastPos and errs
+	r           io.Reader           // source of further input; nil when exhausted
+	fromReader  bool                // input comes from a reader, r, even once exhausted
+	readErr     error               // first error returned by r, other than io.EOF
+	base        int                 // offset of Input[0] within the whole input
+	lines       int                 // newlines in the input discarded before base
+	runes       int                 // number of runes in text discarded before Input
+	lineMu      sync.Mutex          // guards lineStarts
+	lineStarts  []int               // index in Input of the start of each line; built lazily
+	sources     []source            // names of text added by AppendSource
+	tabWidth    int                 // columns per tab stop; 0 or 1 counts a tab as one column
+	digitSep    bool                // allow '_' between digits in numbers
+	space       func(rune) bool     // white space predicate; nil for unicode.IsSpace
+	identCont   func(rune) bool     // word character predicate; nil for IsIdentContinue
+	eofVal      string              // value of EOF tokens
+	runeOffsets bool                // report token positions in runes
+	runeAt      runeMark            // a known rune offset, for converting positions
+	indent      *indentation        // indentation tracking; nil unless enabled
+	nl          *newlines           // significant newline tracking; nil unless enabled
+	trivia      bool                // Ignore emits skipped text as triviaType tokens
+	triviaType  TokenType
+	tracer      func(state string, pos int) // called before each state; nil if unset
+	stuckLimit  int                         // transitions without progress allowed; 0 disables
+	stepPos     int                         // offset at the start of recent transitions
+	idle        int                         // consecutive transitions starting at stepPos
+	stats       counters                    // totals reported by Stats
+	ctxErr      atomic.Pointer[LexError]    // cancellation that cut lexing short, if it was
 }
 
 // NewLexer creates a new scanner for the input string.
 func NewLexer(name, input string, startState StateFn) *Lexer {
-	l := &Lexer{
-		name:   name,
-		Input:  input,
-		state:  startState,
-		tokens: make(chan Token, 2), // two items sufficient
+	return NewLexerWithOptions(name, input, startState)
+}
+
+// NewLexerBytes creates a new scanner for input without copying it.
+// Input and the values of the tokens produced alias the bytes of input,
+// so the caller must not modify input while the lexer or any of its
+// tokens is in use.
+func NewLexerBytes(name string, input []byte, startState StateFn) *Lexer {
+	return NewLexer(name, unsafe.String(unsafe.SliceData(input), len(input)), startState)
+}
+
+// NewLexerContext creates a new scanner for the input string that stops
+// when ctx is cancelled. Once ctx is done, NextToken returns a
+// TokenError describing the cancellation.
+func NewLexerContext(ctx context.Context, name, input string, startState StateFn) *Lexer {
+	return NewLexerWithOptions(name, input, startState, WithContext(ctx))
+}
+
+// NewLexerBuffered creates a new scanner for the input string whose
+// token channel holds up to bufSize tokens. Larger buffers let the
+// lexing goroutine run further ahead of the client, trading memory for
+// throughput. NewLexerBuffered panics if bufSize is less than 1.
+func NewLexerBuffered(name, input string, startState StateFn, bufSize int) *Lexer {
+	return NewLexerWithOptions(name, input, startState, WithBufferSize(bufSize))
+}
+
+// NewLexerSync creates a new scanner for the input string that runs
+// without a goroutine or channel. Each call to NextToken runs state
+// functions on the caller's goroutine until a token has been emitted.
+func NewLexerSync(name, input string, startState StateFn) *Lexer {
+	return NewLexerWithOptions(name, input, startState, WithSync())
+}
+
+// newLexer returns a lexer with no input that has not yet been started.
+func newLexer(name string, startState StateFn) *Lexer {
+	return &Lexer{
+		name:       name,
+		state:      startState,
+		initial:    startState,
+		tokens:     make(chan Token, 2), // two items sufficient
+		done:       make(chan struct{}),
+		finished:   make(chan struct{}),
+		ctx:        context.Background(),
+		stuckLimit: defaultStuckLimit,
+		stepPos:    -1,
 	}
-	go l.run()
-	return l
+}
+
+// start prepares l to begin lexing. The run goroutine of a lexer that
+// is not synchronous is started by the first call to NextToken, so a
+// lexer that is never read costs no goroutine.
+func (l *Lexer) start() {
+	if l.stripBOM {
+		l.SkipBOM()
+	}
+}
+
+// launchRun starts the run goroutine, if it has not already been started.
+func (l *Lexer) launchRun() {
+	l.launch.Do(func() {
+		l.running = true
+		go l.run()
+	})
 }
 
 // Run lexes the input by execute state functions until the state is nil.
 func (l *Lexer) run() {
+	defer l.complete()
+	defer close(l.tokens)
 	for state := l.state; state != nil; {
-		state = state(l)
+		select {
+		case <-l.done:
+			return
+		case <-l.ctx.Done():
+			l.abort()
+			return
+		default:
+		}
+		state = l.step(state)
+	}
+	l.end()
+}
+
+// defaultStuckLimit is the number of consecutive state transitions
+// without consuming input after which a lexer is considered stuck.
+const defaultStuckLimit = 1000
+
+// step runs a single state function, first applying any line-start
+// processing the lexer has been configured with, and returns the next
+// state. A panic in the state function is reported as a TokenError
+// and stops the lexer.
+func (l *Lexer) step(state StateFn) (next StateFn) {
+	defer func() {
+		if r := recover(); r != nil {
+			next = l.Errorf("panic in %s: %v", stateName(state), r)
+		}
+	}()
+	if l.tracer != nil {
+		l.tracer(stateName(state), l.base+l.Pos)
+	}
+	if pos := l.base + l.Pos; pos != l.stepPos {
+		l.stepPos = pos
+		l.idle = 0
+	} else if l.idle++; l.stuckLimit > 0 && l.idle >= l.stuckLimit {
+		return l.Errorf("lexer stuck at position %d", pos)
+	}
+	if l.indent != nil && !l.indent.lineStart(l) {
+		return nil
 	}
+	if next = state(l); l.halted {
+		return nil
+	}
+	return next
+}
+
+// stateName returns the name of the function implementing state.
+func stateName(state StateFn) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(state).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "?"
+}
+
+// Close stops the lexer and discards any tokens not yet returned by
+// NextToken, allowing the run goroutine to exit. Once closed,
+// NextToken returns TokenEOF. Close may be called more than once.
+func (l *Lexer) Close() {
+	l.closing.Do(func() { close(l.done) })
+	if l.tokens == nil || !l.running {
+		l.complete()
+	}
+	l.pending = nil
+	l.ahead = nil
+	for {
+		select {
+		case _, ok := <-l.tokens:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Drain abandons the rest of the token stream: it stops the lexer,
+// discards any tokens not yet returned, and waits for the run
+// goroutine, if any, to exit, after which NextToken returns TokenEOF.
+// Unlike Close, Drain returns only once the lexer has stopped, so Done
+// is closed by the time it returns. Drain may be called more than once
+// and at any point, including after the stream has ended.
+func (l *Lexer) Drain() {
+	l.stop()
+}
+
+// stop closes the lexer and waits for the run goroutine, if any, to exit.
+func (l *Lexer) stop() {
+	l.Close()
+	if l.tokens != nil && l.running {
+		for range l.tokens {
+		}
+		<-l.finished
+	}
+}
+
+// Rewind reinitializes l to scan input from the beginning, starting
+// in startState, so that a lexer can be reused rather than allocated
+// afresh. Any lexing still in progress is stopped first, and tokens
+// from the previous input are discarded. The lexer keeps its buffer
+// size, context and synchronous mode.
+func (l *Lexer) Rewind(name, input string, startState StateFn) {
+	l.reset(name, input, startState)
+	l.start()
+}
+
+// reset stops any lexing in progress and reinitializes l to scan input
+// from the beginning in startState, without starting it.
+func (l *Lexer) reset(name, input string, startState StateFn) {
+	l.stop()
+	if l.tokens != nil {
+		l.tokens = make(chan Token, cap(l.tokens))
+	}
+	l.name = name
+	l.Input = input
+	l.state = startState
+	l.initial = startState
+	l.states = nil
+	l.Start = 0
+	l.Pos = 0
+	l.lastPos = 0
+	l.errs = nil
+	l.stopErr = nil
+	l.ended = false
+	l.ctxErr.Store(nil)
+	l.last = Token{}
+	l.final = nil
+	l.Width = 0
+	l.hist.reset()
+	l.done = make(chan struct{})
+	l.closing = sync.Once{}
+	l.finished = make(chan struct{})
+	l.launch = sync.Once{}
+	l.running = false
+	l.r = nil
+	l.fromReader = false
+	l.readErr = nil
+	l.base = 0
+	l.lines = 0
+	l.runes = 0
+	l.runeAt = runeMark{}
+	l.lineStarts = nil
+	l.sources = nil
+	l.stepPos = -1
+	l.idle = 0
+	l.halted = false
+	l.stats.reset()
+	if l.indent != nil {
+		l.indent.reset()
+	}
+	if l.nl != nil {
+		l.nl.reset()
+	}
+}
+
+// Name returns the name of the input, as used in error reports.
+func (l *Lexer) Name() string {
+	return l.name
+}
+
+// SetName sets the name of the input, as used in error reports.
+func (l *Lexer) SetName(name string) {
+	l.name = name
 }
 
 // LineNumber returns the line number of the current position within the input string.
 func (l *Lexer) LineNumber() int {
-	return strings.Count(l.Input[:l.lastPos], "\n") + 1
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	line, _ := l.position(l.lastPos)
+	return line
+}
+
+// Column returns the 1-based column of the current position within its
+// line. Columns are counted in runes, not bytes, with tabs expanded
+// according to SetTabWidth, and use the same position as LineNumber.
+func (l *Lexer) Column() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, col := l.position(l.lastPos)
+	return col
 }
 
-// NextToken returns the next item from the input.
+// NextToken returns the next item from the input. Once lexing has
+// finished, NextToken keeps returning the final token: the TokenEOF,
+// or the TokenError that stopped the lexer.
 func (l *Lexer) NextToken() Token {
+	if n := len(l.ahead); n > 0 {
+		t := l.ahead[n-1]
+		l.ahead = l.ahead[:n-1]
+		return l.deliver(t)
+	}
+	if l.final != nil {
+		return *l.final
+	}
+	select {
+	case <-l.done:
+		return l.eof(l.endOffset(l.last))
+	default:
+	}
+	if l.tokens == nil {
+		return l.nextSync()
+	}
+	l.launchRun()
+	if l.ctx.Err() != nil {
+		return l.cancelled()
+	}
+	select {
+	case token, ok := <-l.tokens:
+		if !ok {
+			// The channel is closed as well when lexing stops for
+			// cancellation, so check which it was.
+			if l.ctx.Err() != nil {
+				return l.cancelled()
+			}
+			return l.finish()
+		}
+		return l.deliver(token)
+	case <-l.done:
+		return l.eof(l.endOffset(l.last))
+	case <-l.ctx.Done():
+		return l.cancelled()
+	}
+}
+
+// PushBack returns t to the lexer so that it is the next token
+// returned by NextToken. Tokens pushed back more than once are
+// returned in last-in, first-out order.
+func (l *Lexer) PushBack(t Token) {
+	l.ahead = append(l.ahead, t)
+}
+
+// PeekToken returns the next token without consuming it; the same
+// token is returned by the following call to NextToken.
+func (l *Lexer) PeekToken() Token {
+	if len(l.ahead) == 0 {
+		l.PushBack(l.NextToken())
+	}
+	return l.ahead[len(l.ahead)-1]
+}
+
+// All returns every remaining token, up to and including the first
+// TokenEOF or TokenError.
+func (l *Lexer) All() []Token {
+	var tokens []Token
 	for {
-		select {
-		case token := <-l.tokens:
-			l.lastPos = token.Pos
-			return token
-		default:
-			l.state = l.state(l)
+		t := l.NextToken()
+		tokens = append(tokens, t)
+		if t.Typ == TokenEOF || t.Typ == TokenError {
+			return tokens
+		}
+	}
+}
+
+// Tokens returns an iterator over the remaining tokens, up to and
+// including the first TokenEOF or TokenError. If the loop body stops
+// early, the lexer is closed.
+func (l *Lexer) Tokens() iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		for {
+			t := l.NextToken()
+			if !yield(t) {
+				l.Close()
+				return
+			}
+			if t.Typ == TokenEOF || t.Typ == TokenError {
+				return
+			}
 		}
 	}
-	panic("not reached")
+}
+
+// nextSync runs state functions until a token has been emitted.
+func (l *Lexer) nextSync() Token {
+	for len(l.pending) == 0 || l.ctx.Err() != nil {
+		if l.ctx.Err() != nil {
+			l.abort()
+			l.complete()
+			return l.cancelled()
+		}
+		if l.state == nil {
+			l.complete()
+			return l.finish()
+		}
+		if l.state = l.step(l.state); l.state == nil {
+			l.end()
+			l.complete()
+		}
+	}
+	token := l.pending[0]
+	l.pending = append(l.pending[:0], l.pending[1:]...)
+	return l.deliver(token)
+}
+
+// deliver records token as the last one returned to the client.
+func (l *Lexer) deliver(token Token) Token {
+	l.mu.Lock()
+	l.lastPos = token.Pos
+	if l.runeOffsets {
+		l.lastPos = token.off
+	}
+	l.mu.Unlock()
+	l.last = token
+	if token.Typ == TokenEOF {
+		l.final = &l.last
+	}
+	return token
+}
+
+// end is called on the lexing goroutine once the state functions have
+// run to completion. Unless the last token sent ended the input, it
+// sends the token that does: a TokenError for the read error that cut
+// the input short, if there was one, or else a TokenEOF after the
+// input consumed.
+func (l *Lexer) end() {
+	if l.ended || l.stopErr != nil {
+		return
+	}
+	if l.readErr != nil {
+		l.sendError(l.errorOf(l.readErr, l.base+l.Pos, l.readErr.Error()))
+		return
+	}
+	pos := l.base + l.Pos
+	l.send(Token{Typ: TokenEOF, Val: l.eofVal, Pos: pos, End: pos})
+}
+
+// finish records the final token once the state functions have run
+// to completion: the last token delivered if it ended the input,
+// or else a TokenEOF at the end of the input consumed.
+func (l *Lexer) finish() Token {
+	if l.last.Typ != TokenEOF && l.last.Typ != TokenError {
+		l.last = l.eof(l.base + l.Pos)
+	}
+	l.final = &l.last
+	return l.last
+}
+
+// Done returns a channel that is closed once lexing has completed:
+// when the state functions have run to completion, the lexer has been
+// closed, or its context is done. For a lexer running on its own
+// goroutine, the goroutine has exited by the time the channel is
+// closed, though tokens it emitted may remain to be read. Lexing
+// begins with the first call to NextToken, and for a synchronous
+// lexer progresses only as NextToken is called.
+func (l *Lexer) Done() <-chan struct{} {
+	return l.finished
+}
+
+// complete marks lexing as completed, closing the channel returned by
+// Done if it is not already closed. Only the goroutine running the
+// state functions calls it, so the check cannot race with the close.
+func (l *Lexer) complete() {
+	select {
+	case <-l.finished:
+	default:
+		close(l.finished)
+	}
+}
+
+// eof returns the EOF token reported once the lexer has stopped,
+// positioned at the byte offset off.
+func (l *Lexer) eof(off int) Token {
+	pos := off
+	if l.runeOffsets {
+		pos = l.RuneOffset(off)
+	}
+	return Token{Typ: TokenEOF, Val: l.eofVal, Pos: pos, End: pos, off: off}
+}
+
+// endOffset returns the byte offset just past t, a token sent by l
+// whose text is still buffered.
+func (l *Lexer) endOffset(t Token) int {
+	if !l.runeOffsets {
+		return t.End
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	i := l.index(t.off)
+	for n := t.End - t.Pos; n > 0 && i < len(l.Input); n-- {
+		_, w := utf8.DecodeRuneInString(l.Input[i:])
+		i += w
+	}
+	return l.base + i
+}
+
+// cancelled returns the error token reported once l.ctx is done,
+// recording it as the final token so that NextToken keeps returning it.
+func (l *Lexer) cancelled() Token {
+	l.abort()
+	pos := l.lastPos
+	if l.runeOffsets {
+		pos = l.RuneOffset(pos)
+	}
+	l.last = Token{Typ: TokenError, Val: l.ctx.Err().Error(), Pos: pos, End: pos, off: l.lastPos}
+	l.final = &l.last
+	return l.last
 }
 
 // Emit passes an item back to the client
 func (l *Lexer) Emit(t TokenType) {
-	l.tokens <- Token{t, l.Input[l.Start:l.Pos], l.Start}
+	if t == TokenEOF && l.readErr != nil {
+		l.sendError(l.errorOf(l.readErr, l.base+l.Start, l.readErr.Error()))
+		return
+	}
+	l.EmitValue(t, l.Input[l.Start:l.Pos])
+}
+
+// EmitValue passes an item with the given value back to the client.
+// The token spans the source text from Start to Pos, as for Emit,
+// which lets a state function report normalized text such as an
+// unquoted string while keeping its true source position.
+func (l *Lexer) EmitValue(t TokenType, val string) {
+	l.emit(Token{Typ: t, Val: val}, l.Start, l.Pos)
+}
+
+// EmitPayload passes an item back to the client, as for Emit, carrying
+// v as its Payload.
+func (l *Lexer) EmitPayload(t TokenType, v any) {
+	l.emit(Token{Typ: t, Val: l.Input[l.Start:l.Pos], Payload: v}, l.Start, l.Pos)
+}
+
+// EmitWithAttr passes an item back to the client, as for Emit, with
+// attr as its Attr.
+func (l *Lexer) EmitWithAttr(t TokenType, attr any) {
+	l.emit(Token{Typ: t, Val: l.Input[l.Start:l.Pos], Attr: attr}, l.Start, l.Pos)
+}
+
+// EmitRune consumes the next rune and passes it back to the client as
+// an item of type t, together with any text already pending. At the
+// end of the input it emits TokenEOF instead.
+func (l *Lexer) EmitRune(t TokenType) {
+	if l.Next() == EOF {
+		t = TokenEOF
+	}
+	l.Emit(t)
+}
+
+// EmitTrimmed passes an item back to the client holding the pending
+// text with leading and trailing white space removed. The token's Pos
+// and End cover only the trimmed text.
+func (l *Lexer) EmitTrimmed(t TokenType) {
+	cur := l.Input[l.Start:l.Pos]
+	val := strings.TrimLeftFunc(cur, l.isSpace)
+	start := l.Start + len(cur) - len(val)
+	val = strings.TrimRightFunc(val, l.isSpace)
+	l.emit(Token{Typ: t, Val: val}, start, start+len(val))
+}
+
+// emit sends tok positioned to span Input[start:end] and advances
+// Start to Pos.
+func (l *Lexer) emit(tok Token, start, end int) {
+	if l.checkTokenSize() {
+		return
+	}
+	if l.nl != nil {
+		l.nl.emit(l, tok.Typ, tok.Val)
+	}
+	if tok.Typ == TokenEOF && l.indent != nil {
+		l.indent.dedentAll(l)
+	}
+	if tok.Typ == TokenEOF && tok.Val == "" {
+		tok.Val = l.eofVal
+	}
+	if l.normalize != nil && (l.normTypes == nil || l.normTypes[tok.Typ]) && tok.Typ != TokenEOF && tok.Typ != TokenError {
+		tok.Val = l.normalize(tok.Val)
+	}
+	tok.Pos, tok.End = l.base+start, l.base+end
+	l.send(tok)
 	l.Start = l.Pos
+	l.hist.reset()
+	l.stats.consumed.Store(int64(l.base + l.Pos))
+}
+
+// checkTokenSize stops the lexer with an error if the pending token is
+// longer than the limit set by WithMaxTokenSize, reporting whether it
+// did.
+func (l *Lexer) checkTokenSize() bool {
+	if l.maxToken <= 0 || l.Pos-l.Start <= l.maxToken || l.halted {
+		return false
+	}
+	l.fail(l.errorOf(ErrTokenTooLarge, l.base+l.Start, fmt.Sprintf("token too large at %d", l.base+l.Start)))
+	return true
+}
+
+// Current returns the text of the pending token, from Start to Pos.
+func (l *Lexer) Current() string {
+	return l.Input[l.Start:l.Pos]
+}
+
+// Remaining returns the input that has not yet been consumed. For a
+// reader-backed lexer this is only the text buffered so far.
+func (l *Lexer) Remaining() string {
+	return l.Input[l.Pos:]
+}
+
+// Consumed returns the input consumed so far. For a reader-backed
+// lexer this is only the part still buffered.
+func (l *Lexer) Consumed() string {
+	return l.Input[:l.Pos]
 }
 
 // Next returns the next rune in the input.
 func (l *Lexer) Next() rune {
-	if l.Pos >= len(l.Input) {
+	l.checkTokenSize()
+	if l.Pos < len(l.Input) && l.Input[l.Pos] < utf8.RuneSelf && !l.halted {
+		// Fast path for ASCII.
+		r := rune(l.Input[l.Pos])
+		l.Width = 1
+		l.Pos++
+		l.hist.push(1)
+		return r
+	}
+	if !utf8.FullRuneInString(l.Input[l.Pos:]) {
+		l.ensure(utf8.UTFMax)
+	}
+	if l.Pos >= len(l.Input) || l.halted {
 		l.Width = 0
+		l.hist.push(0)
 		return EOF
 	}
 	r, w := utf8.DecodeRuneInString(l.Input[l.Pos:])
+	if r == utf8.RuneError && w == 1 && l.strictUTF8 {
+		l.fail(l.errorOf(ErrInvalidUTF8, l.base+l.Pos, fmt.Sprintf("invalid UTF-8 encoding at offset %d", l.base+l.Pos)))
+		return l.Next()
+	}
 	l.Width = w
 	l.Pos += l.Width
+	l.hist.push(w)
 	return r
 }
 
 // Ignore skips over the pending input before this point.
 func (l *Lexer) Ignore() {
+	if l.nl != nil {
+		l.nl.ignore(l)
+	} else if l.trivia {
+		l.sendTrivia(l.Start, l.Pos)
+	}
 	l.Start = l.Pos
+	l.hist.reset()
+	l.stats.consumed.Store(int64(l.base + l.Pos))
+}
+
+// sendTrivia emits the ignored text Input[i:j] as a trivia token, if
+// trivia tokens are enabled and the text is not empty.
+func (l *Lexer) sendTrivia(i, j int) {
+	if l.trivia && j > i {
+		l.send(Token{Typ: l.triviaType, Val: l.Input[i:j], Pos: l.base + i, End: l.base + j})
+	}
 }
 
-// Backup steps back one rune.
-// Can be called only once per call of next.
+// Backup steps back one rune. It may be called repeatedly to step
+// back over up to maxBackup runes consumed since the last Emit or
+// Ignore; once that history is exhausted Backup does nothing. Backing
+// up over a read that returned EOF leaves Pos unchanged, and any
+// number of such reads may be backed up over without using up the
+// history of real runes.
 func (l *Lexer) Backup() {
-	l.Pos -= l.Width
+	if w, ok := l.hist.pop(); ok {
+		l.Pos -= w
+	}
+	l.Width = l.hist.top()
+}
+
+// BackupN steps back over up to n runes, as if by calling Backup
+// repeatedly, and returns the number of runes stepped back, which is
+// fewer than n if the history runs out first. Reads that returned EOF
+// are stepped over without counting. BackupN does nothing if n <= 0.
+func (l *Lexer) BackupN(n int) int {
+	k := 0
+	for k < n {
+		w, ok := l.hist.pop()
+		if !ok {
+			break
+		}
+		if w > 0 {
+			l.Pos -= w
+			k++
+		}
+	}
+	l.Width = l.hist.top()
+	return k
 }
 
 // Peek returns but does not consume
 // the next rune in the input.
 func (l *Lexer) Peek() rune {
+	pos, width, hist := l.base+l.Pos, l.Width, l.hist
 	r := l.Next()
-	l.Backup()
+	l.Pos, l.Width, l.hist = pos-l.base, width, hist
+	return r
+}
+
+// Prev returns the rune just before Pos, or EOF at the start of the
+// input, without altering the lexer's state. For a reader-backed lexer
+// EOF is also returned if that rune is no longer buffered.
+func (l *Lexer) Prev() rune {
+	if l.Pos == 0 {
+		return EOF
+	}
+	r, _ := utf8.DecodeLastRuneInString(l.Input[:l.Pos])
 	return r
 }
 
+// PeekN returns but does not consume up to n upcoming runes in the
+// input. Fewer than n runes are returned if the input ends first.
+func (l *Lexer) PeekN(n int) []rune {
+	l.ensure(n * utf8.UTFMax)
+	var runes []rune
+	for pos := l.Pos; len(runes) < n && pos < len(l.Input); {
+		r, w := utf8.DecodeRuneInString(l.Input[pos:])
+		runes = append(runes, r)
+		pos += w
+	}
+	return runes
+}
+
+// PeekNonSpace returns but does not consume the first rune after any
+// white space at Pos, or EOF if only white space remains. Neither the
+// white space nor the rune is consumed.
+func (l *Lexer) PeekNonSpace() rune {
+	for i := 0; ; {
+		if !utf8.FullRuneInString(l.Input[l.Pos+i:]) {
+			l.ensure(i + utf8.UTFMax)
+		}
+		if l.Pos+i >= len(l.Input) {
+			return EOF
+		}
+		r, w := utf8.DecodeRuneInString(l.Input[l.Pos+i:])
+		if !l.isSpace(r) {
+			return r
+		}
+		i += w
+	}
+}
+
 // Accept consumes the next rune
 // if it's from the valid set.
 func (l *Lexer) Accept(valid string) bool {
@@ -141,6 +1015,17 @@ func (l *Lexer) Accept(valid string) bool {
 	return false
 }
 
+// AcceptRune consumes the next rune if it's from the valid set,
+// returning it and true. Otherwise nothing is consumed and it returns
+// EOF and false.
+func (l *Lexer) AcceptRune(valid string) (rune, bool) {
+	if r := l.Next(); strings.IndexRune(valid, r) >= 0 {
+		return r, true
+	}
+	l.Backup()
+	return EOF, false
+}
+
 // AcceptRun consumes a run of runes from the valid set.
 func (l *Lexer) AcceptRun(valid string) {
 	for strings.IndexRune(valid, l.Next()) >= 0 {
@@ -148,14 +1033,411 @@ func (l *Lexer) AcceptRun(valid string) {
 	l.Backup()
 }
 
+// HasPrefix reports whether the upcoming input begins with s, without
+// consuming anything; it is false if fewer than len(s) bytes remain.
+// A state function can test with HasPrefix and later consume the text
+// with AcceptString.
+func (l *Lexer) HasPrefix(s string) bool {
+	l.ensure(len(s))
+	return strings.HasPrefix(l.Input[l.Pos:], s)
+}
+
+// AcceptString consumes s if the upcoming input begins with it and
+// reports whether it did. Nothing is consumed if the input does not
+// match. If the lexer stops part way through s, as when s would make
+// the pending token too large, AcceptString reports false.
+func (l *Lexer) AcceptString(s string) bool {
+	if !l.HasPrefix(s) {
+		return false
+	}
+	for end := l.Pos + len(s); l.Pos < end; {
+		if l.Next() == EOF {
+			return false
+		}
+	}
+	return true
+}
+
+// AcceptLongest consumes the longest of alts that the upcoming input
+// begins with and returns it, reporting whether any matched. The order
+// of alts does not matter, so "<" does not shadow "<=". Nothing is
+// consumed if none match; empty alternatives are ignored. As with
+// AcceptString, false is reported if the lexer stops part way.
+func (l *Lexer) AcceptLongest(alts ...string) (string, bool) {
+	n := 0
+	for _, s := range alts {
+		n = max(n, len(s))
+	}
+	l.ensure(n)
+	best, ok := "", false
+	for _, s := range alts {
+		if s != "" && len(s) > len(best) && strings.HasPrefix(l.Input[l.Pos:], s) {
+			best, ok = s, true
+		}
+	}
+	if ok {
+		ok = l.AcceptString(best)
+	}
+	return best, ok
+}
+
+// AcceptStringFold is like AcceptString but compares runes under
+// Unicode case folding. Since folded runes may differ in width, the
+// amount of input consumed need not equal len(s).
+func (l *Lexer) AcceptStringFold(s string) bool {
+	l.ensure(utf8.RuneCountInString(s) * utf8.UTFMax)
+	pos, width, hist := l.Pos, l.Width, l.hist
+	for _, sr := range s {
+		if r := l.Next(); r == EOF || !equalFold(r, sr) {
+			l.Pos, l.Width, l.hist = pos, width, hist
+			return false
+		}
+	}
+	return true
+}
+
+// equalFold reports whether a and b are equal under simple Unicode
+// case folding.
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptN consumes exactly n runes and reports whether it did. If
+// fewer than n runes remain, nothing is consumed.
+func (l *Lexer) AcceptN(n int) bool {
+	l.ensure(n * utf8.UTFMax)
+	pos, width, hist := l.Pos, l.Width, l.hist
+	for i := 0; i < n; i++ {
+		if l.Next() == EOF {
+			l.Pos, l.Width, l.hist = pos, width, hist
+			return false
+		}
+	}
+	return true
+}
+
+// AcceptUntil consumes runes up to, but not including, the first rune
+// from the stop set, or to the end of the input. It reports whether
+// any runes were consumed.
+func (l *Lexer) AcceptUntil(stop string) bool {
+	start := l.base + l.Pos
+	for r := l.Next(); r != EOF && strings.IndexRune(stop, r) < 0; r = l.Next() {
+	}
+	l.Backup()
+	return l.base+l.Pos > start
+}
+
+// AcceptFunc consumes the next rune if pred reports true for it.
+func (l *Lexer) AcceptFunc(pred func(rune) bool) bool {
+	if r := l.Next(); r != EOF && pred(r) {
+		return true
+	}
+	l.Backup()
+	return false
+}
+
+// AcceptRunFunc consumes a run of runes for which pred reports true.
+func (l *Lexer) AcceptRunFunc(pred func(rune) bool) {
+	for r := l.Next(); r != EOF && pred(r); r = l.Next() {
+	}
+	l.Backup()
+}
+
+// AcceptRange consumes the next rune if it lies in the range lo to hi
+// inclusive.
+func (l *Lexer) AcceptRange(lo, hi rune) bool {
+	if r := l.Next(); r != EOF && lo <= r && r <= hi {
+		return true
+	}
+	l.Backup()
+	return false
+}
+
+// AcceptRangeRun consumes a run of runes in the range lo to hi
+// inclusive.
+func (l *Lexer) AcceptRangeRun(lo, hi rune) {
+	for r := l.Next(); r != EOF && lo <= r && r <= hi; r = l.Next() {
+	}
+	l.Backup()
+}
+
+// Mark returns the current position for a later call to Reset.
+func (l *Lexer) Mark() int {
+	return l.base + l.Pos
+}
+
+// Reset moves the lexer back (or forward) to a position returned by
+// Mark, so that a state function can abandon a speculative scan.
+// Tokens emitted since the mark are not retracted; if the mark
+// precedes Start, Start is moved back to it as well. Reset panics if
+// the text at the mark is no longer buffered by a reader-backed lexer.
+func (l *Lexer) Reset(mark int) {
+	i := mark - l.base
+	if i < 0 || i > len(l.Input) {
+		panic("lexer: Reset to a position outside the buffered input")
+	}
+	l.Pos = i
+	if l.Start > l.Pos {
+		l.Start = l.Pos
+	}
+	l.rebuildHistory()
+}
+
+// SeekTo moves both Start and Pos to offset, discarding any pending
+// text, so that lexing resumes from there; a state function can use it
+// to skip to a known position or to return to one to lex a range
+// again. Tokens already emitted are unaffected. An error is returned,
+// and nothing changes, if offset lies outside the input, splits a
+// multibyte rune, or for a reader-backed lexer, is no longer buffered.
+func (l *Lexer) SeekTo(offset int) error {
+	i := offset - l.base
+	if i < 0 || i > len(l.Input) {
+		return l.errorAt(offset, fmt.Sprintf("offset %d outside the input", offset))
+	}
+	if i < len(l.Input) && !utf8.RuneStart(l.Input[i]) {
+		return l.errorAt(offset, fmt.Sprintf("offset %d splits a rune", offset))
+	}
+	l.Start, l.Pos = i, i
+	l.Width = 0
+	l.hist.reset()
+	return nil
+}
+
+// A Snapshot records the scanning state of a lexer, as returned by
+// Save, for a later call to Load.
+type Snapshot struct {
+	start, pos int // offsets in the whole input
+	width      int
+	hist       history
+	states     []StateFn
+}
+
+// Save returns a snapshot of the lexer's scanning state: Start, Pos,
+// Width, the history used by Backup and the state stack.
+func (l *Lexer) Save() Snapshot {
+	return Snapshot{
+		start:  l.base + l.Start,
+		pos:    l.base + l.Pos,
+		width:  l.Width,
+		hist:   l.hist,
+		states: slices.Clone(l.states),
+	}
+}
+
+// Load restores the scanning state recorded by Save, so that a state
+// function can backtrack fully after a speculative scan. As with
+// Reset, tokens emitted since the snapshot are not retracted, and Load
+// panics if the text at the snapshot is no longer buffered by a
+// reader-backed lexer.
+func (l *Lexer) Load(s Snapshot) {
+	start, pos := s.start-l.base, s.pos-l.base
+	if start < 0 || pos > len(l.Input) {
+		panic("lexer: Load of a snapshot outside the buffered input")
+	}
+	l.Start, l.Pos, l.Width = start, pos, s.width
+	l.hist = s.hist
+	l.states = slices.Clone(s.states)
+}
+
+// rebuildHistory records the widths of the runes between Start and
+// Pos, up to maxBackup of them, so that Backup can step back over them.
+func (l *Lexer) rebuildHistory() {
+	var widths [maxBackup]int
+	n := 0
+	for i := l.Pos; i > l.Start && n < maxBackup; n++ {
+		_, w := utf8.DecodeLastRuneInString(l.Input[l.Start:i])
+		widths[n] = w
+		i -= w
+	}
+	l.hist.reset()
+	for n > 0 {
+		n--
+		l.hist.push(widths[n])
+	}
+	l.Width = l.hist.top()
+}
+
+// PushState saves s on the lexer's state stack, typically so that a
+// state handling a nested construct can later return to it.
+func (l *Lexer) PushState(s StateFn) {
+	l.states = append(l.states, s)
+}
+
+// PopState removes and returns the state most recently saved by
+// PushState, or nil if the stack is empty.
+func (l *Lexer) PopState() StateFn {
+	n := len(l.states)
+	if n == 0 {
+		return nil
+	}
+	s := l.states[n-1]
+	l.states = l.states[:n-1]
+	return s
+}
+
+// Enter returns the state registered under name with WithStates, so
+// that a state function can switch to it by returning l.Enter(name).
+// A start state that returns l.Enter(mode) selects the entry point
+// for a mode chosen at run time. If no state is registered under name,
+// Enter reports an error as Errorf does and returns nil.
+func (l *Lexer) Enter(name string) StateFn {
+	if s, ok := l.named[name]; ok {
+		return s
+	}
+	return l.Errorf("unknown state %q", name)
+}
+
 // Errorf returns an error token and terminates the scan
 // by passing back a nil pointer that will be the next
-// state, terminating l.run.
+// state, terminating l.run. The token's LexError records
+// the position of the pending token, l.Start.
 func (l *Lexer) Errorf(format string, args ...interface{}) StateFn {
-	l.tokens <- Token{
-		TokenError,
-		fmt.Sprintf(format, args...),
-		l.Start,
+	l.sendError(l.errorAt(l.base+l.Start, fmt.Sprintf(format, args...)))
+	return nil
+}
+
+// EmitErrorf emits an error token for the pending text, like Errorf,
+// but does not terminate the scan, so that a state function can
+// recover and report further errors. As with Emit, the pending text is
+// consumed by the token. The caller is responsible for advancing past
+// the bad input; a state that reports an error without consuming
+// anything will loop forever. The error does not end the token stream:
+// if the state functions finish without emitting TokenEOF, one is
+// supplied after it, and Err does not report it, though Errors does.
+func (l *Lexer) EmitErrorf(format string, args ...interface{}) {
+	l.sendError(l.errorAt(l.base+l.Start, fmt.Sprintf(format, args...)))
+	l.stopErr = nil // lexing goes on, so the error is not terminal
+	l.Start = l.Pos
+	l.hist.reset()
+	l.stats.consumed.Store(int64(l.base + l.Pos))
+}
+
+// fail reports an error found by the lexer itself rather than by a
+// state function, and stops the lexer: Next returns EOF from then on,
+// leaving Pos where it is even if input remains, tokens emitted
+// afterwards are dropped, and lexing ends when the current state
+// function returns. Any loop reading up to a given offset must
+// therefore stop at EOF too.
+func (l *Lexer) fail(e LexError) {
+	if !l.halted {
+		l.sendError(e)
+		l.halted = true
+	}
+}
+
+// sendError records e and sends an error token for it spanning the
+// input from e.Pos up to Pos.
+func (l *Lexer) sendError(e LexError) {
+	l.mu.Lock()
+	l.errs = append(l.errs, e)
+	l.mu.Unlock()
+	l.stats.errors.Add(1)
+	if l.onError != nil {
+		l.onError(e)
+	}
+	val := e.Msg
+	if l.posErrors {
+		val = e.Error()
+	}
+	l.send(Token{Typ: TokenError, Val: val, Pos: e.Pos, End: l.base + l.Pos, err: &e})
+}
+
+// abort records that lexing was cut short because l.ctx is done, for
+// Err, unless that has already been recorded. The error is positioned
+// where the cancellation token returned by NextToken is. It may be
+// called from either the client's goroutine or the lexing goroutine.
+func (l *Lexer) abort() {
+	err := l.ctx.Err()
+	l.mu.RLock()
+	e := l.errorOf(err, l.lastPos, err.Error())
+	l.mu.RUnlock()
+	l.ctxErr.CompareAndSwap(nil, &e)
+}
+
+// errorAt returns a LexError with the given message positioned at offset.
+func (l *Lexer) errorAt(offset int, msg string) LexError {
+	e := LexError{Msg: msg, Pos: offset}
+	e.Name, e.Line, e.Column = l.sourcePosition(offset)
+	return e
+}
+
+// errorOf returns a LexError of kind err, with the given message,
+// positioned at offset.
+func (l *Lexer) errorOf(err error, offset int, msg string) LexError {
+	e := l.errorAt(offset, msg)
+	e.Err = err
+	return e
+}
+
+// Err returns the error that ended lexing, or nil if lexing ended
+// normally, in the manner of bufio.Scanner's Err. Lexing ended in
+// error if the last token emitted was a TokenError that stopped it, as
+// from Errorf but not EmitErrorf, in which case the error is its
+// LexError, or if it was cut short because the lexer's context was
+// done, in which case the error is a LexError wrapping the context's
+// error, as reported by NextToken. Err returns
+// nil until lexing has completed, as signalled by Done; it may be
+// called from any goroutine once Done is closed.
+func (l *Lexer) Err() error {
+	select {
+	case <-l.finished:
+	default:
+		return nil
+	}
+	if e := l.ctxErr.Load(); e != nil {
+		return *e
+	}
+	if l.stopErr != nil {
+		return *l.stopErr
 	}
 	return nil
 }
+
+// Errors returns every error reported by Errorf or EmitErrorf so far,
+// whether or not the corresponding tokens have been returned by
+// NextToken.
+func (l *Lexer) Errors() []LexError {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]LexError(nil), l.errs...)
+}
+
+// send delivers a token to the client unless the lexer has been closed.
+func (l *Lexer) send(t Token) {
+	if l.halted {
+		return
+	}
+	l.stats.tokens.Add(1)
+	l.stopErr = nil
+	l.ended = t.Typ == TokenEOF
+	if t.Typ == TokenError {
+		e := t.err
+		if e == nil {
+			le := l.errorAt(t.Pos, t.Val)
+			e = &le
+		}
+		l.stopErr = e
+	}
+	if l.runeOffsets {
+		t.off = t.Pos
+		t.Pos, t.End = l.runeIndex(t.Pos), l.runeIndex(t.End)
+	}
+	if l.tokens == nil {
+		l.pending = append(l.pending, t)
+		return
+	}
+	select {
+	case l.tokens <- t:
+	case <-l.done:
+	case <-l.ctx.Done():
+		l.abort()
+	}
+}
@@ -0,0 +1,281 @@
+package lexer
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+)
+
+const tokWord TokenType = iota + 1
+
+// lexWords emits each run of non-space runes as a tokWord, skipping
+// white space, and ends with TokenEOF.
+func lexWords(l *Lexer) StateFn {
+	l.AcceptRunFunc(unicode.IsSpace)
+	l.Ignore()
+	if l.Peek() == EOF {
+		l.Emit(TokenEOF)
+		return nil
+	}
+	l.AcceptRunFunc(func(r rune) bool { return !unicode.IsSpace(r) })
+	l.Emit(tokWord)
+	return lexWords
+}
+
+func TestCloseReleasesGoroutine(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		l := NewLexer("close", strings.Repeat("word ", 1000), lexWords)
+		if tok := l.NextToken(); tok.Typ != tokWord {
+			t.Fatalf("first token = %v, want a word", tok)
+		}
+		l.Close()
+		if tok := l.NextToken(); tok.Typ != TokenEOF {
+			t.Fatalf("token after Close = %v, want EOF", tok)
+		}
+	}
+	// The run goroutines exit asynchronously once they see Close.
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines running after Close, want at most %d", n, before)
+	}
+}
+
+func BenchmarkBufferSize(b *testing.B) {
+	input := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 10000)
+	for _, size := range []int{2, 16, 256} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				l := NewLexerBuffered("bench", input, lexWords, size)
+				for l.NextToken().Typ != TokenEOF {
+				}
+			}
+		})
+	}
+}
+
+func TestAcceptStringFold(t *testing.T) {
+	tests := []struct {
+		input, s string
+		want     bool
+		pos      int // Pos afterwards
+	}{
+		{"SeLeCt *", "select", true, 6},
+		{"select", "SELECT", true, 6},
+		{"sel", "select", false, 0},
+		{"selext", "select", false, 0},
+		{"ΣΊΣΥΦΟΣ", "σίσυφος", true, len("ΣΊΣΥΦΟΣ")},
+		{"Kelvin", "kelvin", true, 8},      // Kelvin sign is 3 bytes, k is 1
+		{"ſtop", "STOP", true, 5},          // long s is 2 bytes, S is 1
+		{"İstanbul", "istanbul", false, 0}, // İ has no simple fold to i
+	}
+	for _, tc := range tests {
+		l := &Lexer{Input: tc.input}
+		if got := l.AcceptStringFold(tc.s); got != tc.want || l.Pos != tc.pos {
+			t.Errorf("AcceptStringFold(%q) on %q = %v with Pos %d, want %v with Pos %d",
+				tc.s, tc.input, got, l.Pos, tc.want, tc.pos)
+		}
+	}
+}
+
+func TestReadPastEOF(t *testing.T) {
+	// lexOne emits one token and stops without emitting TokenEOF, so
+	// the lexer must supply one, after the text consumed.
+	lexOne := func(l *Lexer) StateFn {
+		l.AcceptRunFunc(unicode.IsLetter)
+		l.Emit(tokWord)
+		l.AcceptRunFunc(unicode.IsSpace)
+		return nil
+	}
+	for _, sync := range []bool{false, true} {
+		var l *Lexer
+		if sync {
+			l = NewLexerSync("past", "abcde  ", lexOne)
+		} else {
+			l = NewLexer("past", "abcde  ", lexOne)
+		}
+		if tok := l.NextToken(); tok.Val != "abcde" {
+			t.Fatalf("sync=%v: first token = %v, want abcde", sync, tok)
+		}
+		for i := 0; i < 10; i++ {
+			tok := l.NextToken()
+			if tok.Typ != TokenEOF || tok.Pos != 7 || tok.End != 7 {
+				t.Fatalf("sync=%v: read %d past the end = %v at %d-%d, want EOF at 7-7",
+					sync, i, tok, tok.Pos, tok.End)
+			}
+		}
+	}
+}
+
+func TestTerminalTokenRepeats(t *testing.T) {
+	lexFail := func(l *Lexer) StateFn {
+		l.AcceptRunFunc(unicode.IsLetter)
+		l.Emit(tokWord)
+		return l.Errorf("bad input at %d", l.Pos)
+	}
+	tests := []struct {
+		name  string
+		state StateFn
+		want  TokenType
+	}{
+		{"eof", lexWords, TokenEOF},
+		{"error", lexFail, TokenError},
+	}
+	for _, tc := range tests {
+		for _, sync := range []bool{false, true} {
+			var l *Lexer
+			if sync {
+				l = NewLexerSync(tc.name, "word", tc.state)
+			} else {
+				l = NewLexer(tc.name, "word", tc.state)
+			}
+			l.NextToken()
+			final := l.NextToken()
+			if final.Typ != tc.want {
+				t.Fatalf("%s, sync=%v: final token = %v, want type %d", tc.name, sync, final, tc.want)
+			}
+			for i := 0; i < 100; i++ {
+				if tok := l.NextToken(); tok != final {
+					t.Fatalf("%s, sync=%v: call %d after the end = %v, want %v", tc.name, sync, i, tok, final)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkNext(b *testing.B) {
+	benchmarks := []struct {
+		name, input string
+	}{
+		{"ascii", strings.Repeat("func main() { return x + 1 }\n", 1000)},
+		{"multibyte", strings.Repeat("функция главная() { вернуть х }\n", 1000)},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.SetBytes(int64(len(bm.input)))
+			for i := 0; i < b.N; i++ {
+				l := &Lexer{Input: bm.input}
+				for l.Next() != EOF {
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNewLexerBytes(b *testing.B) {
+	input := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 1500))
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(input)))
+		for i := 0; i < b.N; i++ {
+			l := NewLexer("bench", string(input), lexWords)
+			l.NextToken()
+			l.Close()
+		}
+	})
+	b.Run("bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(input)))
+		for i := 0; i < b.N; i++ {
+			l := NewLexerBytes("bench", input, lexWords)
+			l.NextToken()
+			l.Close()
+		}
+	})
+}
+
+func TestBackupAtEOF(t *testing.T) {
+	const input = "aé漢" // runes of 1, 2 and 3 bytes
+	l := &Lexer{Input: input}
+	steps := []struct {
+		op   string // "next", "backup" or "peek"
+		want rune   // rune returned by next or peek
+		pos  int    // Pos afterwards
+	}{
+		{"next", 'a', 1},
+		{"next", 'é', 3},
+		{"next", '漢', 6},
+		{"next", EOF, 6},
+		{"next", EOF, 6},
+		{"peek", EOF, 6},
+		{"backup", 0, 6}, // each EOF read is backed up over on its own
+		{"backup", 0, 6},
+		{"backup", 0, 3},
+		{"next", '漢', 6},
+		{"next", EOF, 6},
+		{"backup", 0, 6},
+		{"backup", 0, 3},
+		{"backup", 0, 1},
+		{"peek", 'é', 1},
+		{"next", 'é', 3},
+		{"next", '漢', 6},
+		{"next", EOF, 6},
+		{"backup", 0, 6},
+		{"backup", 0, 3},
+		{"backup", 0, 1},
+		{"backup", 0, 0},
+		{"backup", 0, 0}, // the history is exhausted
+		{"next", 'a', 1},
+	}
+	for i, s := range steps {
+		var r rune
+		switch s.op {
+		case "next":
+			r = l.Next()
+		case "peek":
+			r = l.Peek()
+		case "backup":
+			l.Backup()
+		}
+		if r != s.want || l.Pos != s.pos {
+			t.Fatalf("step %d (%s): got %q with Pos %d, want %q with Pos %d", i, s.op, r, l.Pos, s.want, s.pos)
+		}
+	}
+}
+
+func TestEmitErrorfIsRecoverable(t *testing.T) {
+	// lexRecover reports each "!" with EmitErrorf and carries on,
+	// returning nil at the end of the input without emitting TokenEOF.
+	var lexRecover StateFn
+	lexRecover = func(l *Lexer) StateFn {
+		switch l.SkipWhitespace(); l.Peek() {
+		case EOF:
+			return nil
+		case '!':
+			l.Next()
+			l.EmitErrorf("unexpected %q", "!")
+		default:
+			l.AcceptRunFunc(func(r rune) bool { return r != '!' && !unicode.IsSpace(r) })
+			l.Emit(tokWord)
+		}
+		return lexRecover
+	}
+	for _, sync := range []bool{false, true} {
+		var l *Lexer
+		if sync {
+			l = NewLexerSync("recover", "a ! b!", lexRecover)
+		} else {
+			l = NewLexer("recover", "a ! b!", lexRecover)
+		}
+		want := []TokenType{tokWord, TokenError, tokWord, TokenError, TokenEOF, TokenEOF, TokenEOF}
+		for i, typ := range want {
+			if tok := l.NextToken(); tok.Typ != typ {
+				t.Fatalf("sync=%v: token %d = %v, want type %d", sync, i, tok, typ)
+			}
+		}
+		<-l.Done()
+		if err := l.Err(); err != nil {
+			t.Errorf("sync=%v: Err() = %v, want nil", sync, err)
+		}
+		if n := len(l.Errors()); n != 2 {
+			t.Errorf("sync=%v: %d errors recorded, want 2", sync, n)
+		}
+	}
+}
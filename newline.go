@@ -0,0 +1,113 @@
+package lexer
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// NewlineConfig configures the significant newline tokens enabled by
+// WithNewlines.
+type NewlineConfig struct {
+	Type      TokenType // type of the token emitted at each line end
+	KeepBlank bool      // emit a token for blank lines as well
+	Brackets  string    // pairs of runes, such as "()[]{}", between which line breaks are not significant; see WithNewlines
+}
+
+// newlines tracks logical lines for lexers created with WithNewlines.
+type newlines struct {
+	NewlineConfig
+	depth   int  // nesting depth of open brackets
+	content bool // a token has been emitted since the last line end
+}
+
+// WithNewlines makes line breaks significant, for grammars in which
+// they terminate statements. Whenever text containing a line break is
+// passed over by Ignore, as by SkipWhitespace, a token of type cfg.Type
+// whose value is the line break is emitted for it, so that state
+// functions may otherwise ignore white space as usual. Line breaks
+// within tokens that are emitted are not affected.
+//
+// As with Python's logical lines, no token is emitted for a line
+// break ending a blank line unless cfg.KeepBlank is set, nor for line
+// breaks between the brackets listed in cfg.Brackets. Brackets are
+// recognized only as tokens whose whole value is the one bracket rune,
+// so each must be emitted as a token of its own: a token such as "(("
+// or "(x" does not open a bracket, nor does one in a string literal.
+// A final token is emitted at the end of the input if the last line
+// was not terminated. When used with WithIndentation, the continuation
+// lines of bracketed expressions do not affect the indentation either.
+func WithNewlines(cfg NewlineConfig) Option {
+	return func(l *Lexer) {
+		l.nl = &newlines{NewlineConfig: cfg}
+	}
+}
+
+func (nl *newlines) reset() {
+	nl.depth = 0
+	nl.content = false
+}
+
+// bracketed reports whether a bracketed expression is open. It may be
+// called on a nil *newlines.
+func (nl *newlines) bracketed() bool {
+	return nl != nil && nl.depth > 0
+}
+
+// emit updates the line state for a token of type t about to be sent,
+// emitting a final line end before a TokenEOF if one is due.
+func (nl *newlines) emit(l *Lexer, t TokenType, val string) {
+	switch {
+	case t == nl.Type:
+		return
+	case t == TokenEOF:
+		if nl.content && nl.depth == 0 {
+			nl.content = false
+			l.send(Token{Typ: nl.Type, Pos: l.base + l.Start, End: l.base + l.Start})
+		}
+		return
+	case l.indent != nil && (t == l.indent.indent || t == l.indent.dedent):
+		return
+	}
+	nl.content = true
+	r, size := utf8.DecodeRuneInString(val)
+	if size == 0 || size != len(val) {
+		return
+	}
+	k := 0
+	for _, b := range nl.Brackets {
+		if b == r {
+			if k%2 == 0 {
+				nl.depth++
+			} else if nl.depth > 0 {
+				nl.depth--
+			}
+			return
+		}
+		k++
+	}
+}
+
+// ignore emits tokens for the significant line breaks between Start
+// and Pos, which are about to be ignored, together with trivia tokens
+// for the text around them if enabled.
+func (nl *newlines) ignore(l *Lexer) {
+	from := l.Start
+	for i := l.Start; ; {
+		j := strings.IndexAny(l.Input[i:l.Pos], "\r\n")
+		if j < 0 {
+			break
+		}
+		start := i + j
+		i = start + 1
+		if l.Input[start] == '\r' && i < l.Pos && l.Input[i] == '\n' {
+			i++
+		}
+		if nl.depth == 0 && (nl.content || nl.KeepBlank) {
+			l.sendTrivia(from, start)
+			l.send(Token{Typ: nl.Type, Val: l.Input[start:i], Pos: l.base + start, End: l.base + i})
+			from = i
+		}
+		nl.content = false
+	}
+	l.sendTrivia(from, l.Pos)
+}
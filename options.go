@@ -0,0 +1,232 @@
+package lexer
+
+import "context"
+
+// An Option configures a lexer created by NewLexerWithOptions.
+type Option func(*Lexer)
+
+// NewLexerWithOptions creates a new scanner for the input string,
+// configured by the given options.
+func NewLexerWithOptions(name, input string, startState StateFn, opts ...Option) *Lexer {
+	l := newLexer(name, startState)
+	l.Input = input
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.start()
+	return l
+}
+
+// WithContext stops the lexer when ctx is cancelled. Once ctx is done,
+// NextToken returns a TokenError describing the cancellation.
+func WithContext(ctx context.Context) Option {
+	return func(l *Lexer) {
+		l.ctx = ctx
+	}
+}
+
+// WithBufferSize sets the number of tokens the lexing goroutine may
+// produce ahead of the client. Larger buffers trade memory for
+// throughput. It has no effect on a synchronous lexer, and panics if n
+// is less than 1.
+func WithBufferSize(n int) Option {
+	if n < 1 {
+		panic("lexer: buffer size must be at least 1")
+	}
+	return func(l *Lexer) {
+		if l.tokens != nil {
+			l.tokens = make(chan Token, n)
+		}
+	}
+}
+
+// WithSync makes the lexer run without a goroutine or channel, as for
+// NewLexerSync.
+func WithSync() Option {
+	return func(l *Lexer) {
+		l.tokens = nil
+	}
+}
+
+// WithTabWidth sets the number of columns between tab stops, as for
+// SetTabWidth.
+func WithTabWidth(n int) Option {
+	return func(l *Lexer) {
+		l.tabWidth = n
+	}
+}
+
+// WithDigitSeparators allows single underscores between the digits of
+// numbers scanned by ScanNumber, as in "1_000_000".
+func WithDigitSeparators() Option {
+	return func(l *Lexer) {
+		l.digitSep = true
+	}
+}
+
+// WithTracer calls trace before each state function runs, with the
+// state's function name, as reported by the runtime, and the current
+// offset in the input. Closures are named after their enclosing
+// function, such as "main.lexText.func1"; a state that needs a clearer
+// name can be wrapped in a named function.
+func WithTracer(trace func(state string, pos int)) Option {
+	return func(l *Lexer) {
+		l.tracer = trace
+	}
+}
+
+// WithStuckLimit sets the number of consecutive state transitions that
+// may run without consuming input before the lexer gives up with a
+// TokenError reporting that it is stuck. This turns a state function
+// that never advances into a diagnosable error rather than a hang. The
+// default is 1000; a limit of 0 disables the check.
+func WithStuckLimit(n int) Option {
+	return func(l *Lexer) {
+		l.stuckLimit = n
+	}
+}
+
+// WithTrivia makes Ignore emit the text it skips, such as white space
+// and comments, as a token of type t instead of dropping it, so that
+// the token stream covers the whole input. This allows a formatter to
+// reproduce comments and layout.
+func WithTrivia(t TokenType) Option {
+	return func(l *Lexer) {
+		l.trivia = true
+		l.triviaType = t
+	}
+}
+
+// WithErrorHandler calls handle for every error reported by Errorf or
+// EmitErrorf, on the goroutine running the state functions and before
+// the error token is emitted. The error token is emitted as usual, so
+// the handler complements rather than replaces the token stream; it
+// suits logging or collecting errors in one place.
+func WithErrorHandler(handle func(LexError)) Option {
+	return func(l *Lexer) {
+		l.onError = handle
+	}
+}
+
+// WithPositionalErrors controls whether the values of error tokens
+// from Errorf and EmitErrorf are prefixed with the input name, line
+// and column, as in "config.txt:4:12: unexpected '#'". By default
+// they hold only the formatted message. Either way, the token's
+// LexError carries the components separately.
+func WithPositionalErrors(enable bool) Option {
+	return func(l *Lexer) {
+		l.posErrors = enable
+	}
+}
+
+// WithStrictUTF8 makes invalid UTF-8 in the input a lexing error. When
+// Next meets an invalid encoding, an error token reporting its offset
+// is emitted and the lexer stops; Next returns EOF to the current state
+// function, without advancing Pos, and any tokens it goes on to emit
+// are discarded. Loops that call Next until Pos reaches a known offset
+// must therefore also stop at EOF, as the package's helpers do. By
+// default invalid bytes are returned as utf8.RuneError.
+func WithStrictUTF8() Option {
+	return func(l *Lexer) {
+		l.strictUTF8 = true
+	}
+}
+
+// WithBOMStripping skips a UTF-8 byte order mark at the start of the
+// input before the first state function runs, as if it had called
+// SkipBOM. By default a mark is left in the input.
+func WithBOMStripping() Option {
+	return func(l *Lexer) {
+		l.stripBOM = true
+	}
+}
+
+// WithMaxTokenSize limits the text of a single token to n bytes, to
+// bound the memory used on untrusted input such as a string literal
+// that is never closed. Once more than n bytes are pending and Next is
+// called, or a token longer than n bytes is emitted, an error token
+// reporting "token too large" is emitted in its place and the lexer
+// stops, as for WithStrictUTF8. Reading one rune of lookahead past a
+// token of exactly n bytes is allowed. A limit of zero, the default,
+// means no limit.
+func WithMaxTokenSize(n int) Option {
+	return func(l *Lexer) {
+		l.maxToken = n
+	}
+}
+
+// WithNormalizer rewrites the values of emitted tokens of the given
+// types with normalize, or of all types but TokenEOF and TokenError if
+// none are given. It is intended for Unicode normalization, so that
+// identifiers spelled with different code point sequences compare
+// equal; with the golang.org/x/text/unicode/norm package, pass
+// norm.NFC.String. Only token values change: the input itself is not
+// normalized, so Pos, End and Current still refer to the original text.
+func WithNormalizer(normalize func(string) string, types ...TokenType) Option {
+	return func(l *Lexer) {
+		l.normalize = normalize
+		l.normTypes = nil
+		if len(types) > 0 {
+			l.normTypes = make(map[TokenType]bool, len(types))
+			for _, t := range types {
+				l.normTypes[t] = true
+			}
+		}
+	}
+}
+
+// WithStates registers the state functions in states under their keys
+// for use with Enter, adding to any registered by earlier options.
+func WithStates(states map[string]StateFn) Option {
+	return func(l *Lexer) {
+		if l.named == nil {
+			l.named = make(map[string]StateFn, len(states))
+		}
+		for name, s := range states {
+			l.named[name] = s
+		}
+	}
+}
+
+// WithWhitespace sets the predicate deciding what counts as white
+// space for SkipWhitespace, PeekNonSpace and EmitTrimmed, in place of
+// unicode.IsSpace; for instance, one excluding U+00A0 keeps no-break
+// spaces from being skipped. Indentation tracked by WithIndentation is
+// always made of spaces and tabs.
+func WithWhitespace(isSpace func(rune) bool) Option {
+	return func(l *Lexer) {
+		l.space = isSpace
+	}
+}
+
+// WithIdentContinue sets the predicate deciding which runes may
+// continue an identifier for AtWordBoundary and Keywords.Match, in
+// place of IsIdentContinue; a language allowing '-' in names, for
+// instance, can include it.
+func WithIdentContinue(isIdent func(rune) bool) Option {
+	return func(l *Lexer) {
+		l.identCont = isIdent
+	}
+}
+
+// WithEOFValue sets the value carried by TokenEOF tokens, such as
+// "<eof>", making the end of the stream visible when tokens are
+// serialized. By default the value is empty. Token.String renders an
+// EOF token as "EOF" either way.
+func WithEOFValue(val string) Option {
+	return func(l *Lexer) {
+		l.eofVal = val
+	}
+}
+
+// WithRuneOffsets makes the Pos and End of emitted tokens count runes
+// rather than bytes, for consumers such as editors that index text by
+// rune. Other offsets are unaffected and remain byte offsets, among
+// them those taken by Position and Snippet and the Pos of a LexError;
+// Lexer.RuneOffset converts them. By default token positions are byte
+// offsets.
+func WithRuneOffsets() Option {
+	return func(l *Lexer) {
+		l.runeOffsets = true
+	}
+}
@@ -0,0 +1,126 @@
+package lexer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+const tokString TokenType = tokWord + 1
+
+// lexQuoted emits words as lexWords does and double-quoted strings as
+// tokString, failing on a string that is never closed.
+func lexQuoted(l *Lexer) StateFn {
+	if l.Peek() != '"' {
+		return lexWords
+	}
+	l.Next()
+	for {
+		switch l.Next() {
+		case '"':
+			l.Emit(tokString)
+			return lexQuoted
+		case EOF:
+			return l.Errorf("unterminated string")
+		}
+	}
+}
+
+func TestMaxTokenSize(t *testing.T) {
+	const max = 16
+	tests := []struct {
+		name  string
+		input string
+		state StateFn
+		want  []string // values of the tokens before the error, if any
+		err   bool
+	}{
+		{"unterminated", `word "` + strings.Repeat("a", 1<<20), lexQuoted, []string{"word"}, true},
+		{"terminated", `word "` + strings.Repeat("a", max-2) + `"`, lexQuoted, []string{"word", `"` + strings.Repeat("a", max-2) + `"`}, false},
+		{"exact", strings.Repeat("a", max) + " b", lexWords, []string{strings.Repeat("a", max), "b"}, false},
+		{"accept", "abcdefghijklmnopqrstuvwxyz", func(l *Lexer) StateFn {
+			l.AcceptN(max + 1)
+			l.Emit(tokWord)
+			return nil
+		}, nil, true},
+	}
+	for _, tc := range tests {
+		l := NewLexerWithOptions(tc.name, tc.input, tc.state, WithMaxTokenSize(max))
+		var got []string
+		tok := l.NextToken()
+		for ; tok.Typ != TokenEOF && tok.Typ != TokenError; tok = l.NextToken() {
+			got = append(got, tok.Val)
+		}
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%s: tokens %q, want %q", tc.name, got, tc.want)
+		}
+		if !tc.err {
+			if tok.Typ != TokenEOF {
+				t.Errorf("%s: final token %v, want EOF", tc.name, tok)
+			}
+			continue
+		}
+		e, ok := tok.LexError()
+		if !ok || !errors.Is(e, ErrTokenTooLarge) {
+			t.Errorf("%s: final token %v, want a token too large error", tc.name, tok)
+			continue
+		}
+		if n := tok.End - tok.Pos; n > max+utf8.UTFMax {
+			t.Errorf("%s: error spans %d bytes, want at most %d", tc.name, n, max+utf8.UTFMax)
+		}
+	}
+}
+
+func TestMaxTokenSizeStopsHelpers(t *testing.T) {
+	keywords := NewKeywords(map[string]TokenType{"interface": tokWord})
+	tests := []struct {
+		name, input string
+		max         int
+		scan        func(l *Lexer)
+	}{
+		{"AcceptString", "abcdef", 3, func(l *Lexer) { l.AcceptString("abcdef") }},
+		{"AcceptLongest", "abcdef", 3, func(l *Lexer) { l.AcceptLongest("abc", "abcdef") }},
+		{"Keywords.Match", "interface", 3, func(l *Lexer) { keywords.Match(l) }},
+		{"ScanQuotedString", `"\n"`, 1, func(l *Lexer) { l.ScanQuotedString('"') }},
+		{"SkipNestedComment", "/* /* */ */", 2, func(l *Lexer) { l.SkipNestedComment("/*", "*/") }},
+	}
+	for _, tc := range tests {
+		l := NewLexerWithOptions(tc.name, tc.input, func(l *Lexer) StateFn {
+			tc.scan(l)
+			l.Emit(tokWord)
+			return nil
+		}, WithMaxTokenSize(tc.max), WithSync())
+		done := make(chan Token)
+		go func() { done <- l.NextToken() }()
+		select {
+		case tok := <-done:
+			if e, ok := tok.LexError(); !ok || !errors.Is(e, ErrTokenTooLarge) {
+				t.Errorf("%s: token %v, want a token too large error", tc.name, tok)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: still scanning after the limit was reached", tc.name)
+		}
+	}
+}
+
+func TestStrictUTF8StopsHelpers(t *testing.T) {
+	l := NewLexerWithOptions("strict", "a\xffb", func(l *Lexer) StateFn {
+		if l.AcceptString("a\xffb") {
+			t.Error("AcceptString accepted invalid UTF-8")
+		}
+		l.Emit(tokWord)
+		return nil
+	}, WithStrictUTF8(), WithSync())
+	done := make(chan Token)
+	go func() { done <- l.NextToken() }()
+	select {
+	case tok := <-done:
+		if e, ok := tok.LexError(); !ok || !errors.Is(e, ErrInvalidUTF8) {
+			t.Errorf("token %v, want an invalid UTF-8 error", tok)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AcceptString still scanning after invalid UTF-8")
+	}
+}
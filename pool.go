@@ -0,0 +1,37 @@
+package lexer
+
+import "sync"
+
+var lexerPool sync.Pool
+
+// GetLexer returns a lexer for the input string, as NewLexer does, but
+// reuses a lexer previously released with PutLexer when one is
+// available.
+//
+// A pooled lexer is restarted by Rewind before it is returned, so it
+// never delivers tokens from an earlier input, and any tab width set
+// by its previous user is cleared, so it behaves as a lexer from
+// NewLexer would. Once a lexer has been
+// passed to PutLexer it must not be used again, not even to look up
+// the positions of tokens it returned.
+func GetLexer(name, input string, startState StateFn) *Lexer {
+	if l, ok := lexerPool.Get().(*Lexer); ok {
+		l.tabWidth = 0
+		l.Rewind(name, input, startState)
+		return l
+	}
+	l := NewLexer(name, input, startState)
+	l.pooled = true
+	return l
+}
+
+// PutLexer stops l, discarding any tokens it has not yet delivered,
+// and releases it for reuse by GetLexer. The caller must not use l
+// afterwards. Lexers that were not obtained from GetLexer are stopped
+// but not pooled.
+func PutLexer(l *Lexer) {
+	l.stop()
+	if l.pooled {
+		lexerPool.Put(l)
+	}
+}
@@ -0,0 +1,180 @@
+package lexer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Position returns the 1-based line and column of the given byte offset
+// in the input, such as the Pos of a token returned earlier. Columns
+// are counted in runes, with tabs expanded according to SetTabWidth.
+// Offsets outside the input are clamped to its start or end rather
+// than causing a panic; for a reader-backed lexer, offsets in text no
+// longer buffered are clamped to the start of the buffer. Each call
+// takes O(log n) time in the number of lines, using a table of line
+// offsets built on first use.
+func (l *Lexer) Position(offset int) (line, col int) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.position(offset)
+}
+
+// Pos is the fully resolved position of a token, as returned by
+// Resolve.
+type Pos struct {
+	Offset int // offset of the token in the input, as in Token.Pos
+	Line   int // 1-based line number
+	Column int // 1-based column, counted as for Position
+}
+
+// Resolve returns the offset, line and column of t, which must have
+// come from l. Lines and columns are not stored in tokens, to keep
+// them small; instead each call looks up t's line with a binary search
+// of the table of line offsets built on first use, taking O(log n)
+// time in the number of lines. Resolve may be called at any time,
+// including after lexing has completed.
+func (l *Lexer) Resolve(t Token) Pos {
+	off := t.Pos
+	if l.runeOffsets {
+		off = t.off
+	}
+	line, col := l.Position(off)
+	return Pos{Offset: t.Pos, Line: line, Column: col}
+}
+
+// position returns the 1-based line and column of offset. The caller
+// must hold l.mu unless it is running on the lexing goroutine.
+func (l *Lexer) position(offset int) (line, col int) {
+	i := l.index(offset)
+	starts := l.lineTable()
+	n := sort.SearchInts(starts, i+1) // lines starting at or before i
+	line = l.lines + n
+	return line, l.column(l.Input[starts[n-1]:i])
+}
+
+// column returns the 1-based column reached after text, the start of
+// a line, honoring the lexer's tab width.
+func (l *Lexer) column(text string) int {
+	if l.tabWidth <= 1 {
+		return utf8.RuneCountInString(text) + 1
+	}
+	col := 1
+	for _, r := range text {
+		if r == '\t' {
+			col += l.tabWidth - (col-1)%l.tabWidth
+		} else {
+			col++
+		}
+	}
+	return col
+}
+
+// Describe returns t rendered as by Token.String followed by the line
+// and column of its position in l's input, as in IDENT("foo")@3:5.
+func (l *Lexer) Describe(t Token) string {
+	p := l.Resolve(t)
+	return fmt.Sprintf("%s@%d:%d", t, p.Line, p.Column)
+}
+
+// Snippet returns the line of input containing offset followed by a
+// line with a caret under the rune at offset, for showing the context
+// of an error:
+//
+//	x := 3 $ 4
+//	       ^
+//
+// Tabs before the offset are repeated in the caret line, so the caret
+// stays aligned however tabs are displayed. Offsets are clamped as for
+// Position, and the returned text has no trailing line break.
+func (l *Lexer) Snippet(offset int) string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	i := l.index(offset)
+	starts := l.lineTable()
+	start := starts[sort.SearchInts(starts, i+1)-1]
+	end := len(l.Input)
+	if j := strings.IndexAny(l.Input[start:], "\r\n"); j >= 0 {
+		end = start + j
+	}
+	var b strings.Builder
+	b.WriteString(l.Input[start:end])
+	b.WriteByte('\n')
+	for _, r := range l.Input[start:min(i, end)] {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteByte('^')
+	return b.String()
+}
+
+// UTF16Column returns the 1-based column of offset counted in UTF-16
+// code units, as the Language Server Protocol counts characters within
+// a line: runes outside the Basic Multilingual Plane, such as most
+// emoji, count as two, and a tab counts as one. LSP positions are
+// zero-based, so subtract one for use there. Offsets are clamped as
+// for Position.
+func (l *Lexer) UTF16Column(offset int) int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	i := l.index(offset)
+	starts := l.lineTable()
+	col := 1
+	for _, r := range l.Input[starts[sort.SearchInts(starts, i+1)-1]:i] {
+		if r >= 0x10000 {
+			col += 2
+		} else {
+			col++
+		}
+	}
+	return col
+}
+
+// SetTabWidth sets the number of columns between tab stops used when
+// computing columns. With the default width of 1, a tab counts as a
+// single column like any other rune.
+func (l *Lexer) SetTabWidth(n int) {
+	l.mu.Lock()
+	l.tabWidth = n
+	l.mu.Unlock()
+}
+
+// lineTable returns the index in Input of the start of each line,
+// building it if necessary. Lines end at "\n", "\r\n" or a lone "\r".
+func (l *Lexer) lineTable() []int {
+	l.lineMu.Lock()
+	defer l.lineMu.Unlock()
+	if l.lineStarts == nil {
+		starts := []int{0}
+		for i := 0; ; {
+			j := strings.IndexAny(l.Input[i:], "\r\n")
+			if j < 0 {
+				break
+			}
+			i += j + 1
+			if l.Input[i-1] == '\r' && i < len(l.Input) && l.Input[i] == '\n' {
+				i++
+			}
+			starts = append(starts, i)
+		}
+		l.lineStarts = starts
+	}
+	return l.lineStarts
+}
+
+// index converts an offset within the whole input into an index into
+// Input, clamping offsets that fall outside the buffered text.
+func (l *Lexer) index(offset int) int {
+	i := offset - l.base
+	if i < 0 {
+		return 0
+	}
+	if i > len(l.Input) {
+		return len(l.Input)
+	}
+	return i
+}
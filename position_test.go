@@ -0,0 +1,77 @@
+package lexer
+
+import "testing"
+
+func TestLineEndings(t *testing.T) {
+	l := NewLexer("endings", "a\r\nb\rc\nd\r\n\re  f\r\n\n\r  g", lexWords)
+	want := []struct {
+		val       string
+		line, col int
+	}{
+		{"a", 1, 1},
+		{"b", 2, 1},
+		{"c", 3, 1},
+		{"d", 4, 1},
+		{"e", 6, 1},
+		{"f", 6, 4},
+		{"g", 9, 3},
+	}
+	for _, w := range want {
+		tok := l.NextToken()
+		if tok.Val != w.val {
+			t.Fatalf("token = %v, want %q", tok, w.val)
+		}
+		if line, col := l.LineNumber(), l.Column(); line != w.line || col != w.col {
+			t.Errorf("%q at %d:%d, want %d:%d", w.val, line, col, w.line, w.col)
+		}
+	}
+}
+
+func TestTabWidth(t *testing.T) {
+	const input = "\tab\n \tcd\n  \t\tef\nx\t y"
+	tests := []struct {
+		width int
+		cols  []int // columns of ab, cd, ef, x and y
+	}{
+		{0, []int{2, 3, 5, 1, 4}},
+		{1, []int{2, 3, 5, 1, 4}},
+		{4, []int{5, 5, 9, 1, 6}},
+		{8, []int{9, 9, 17, 1, 10}},
+	}
+	for _, tc := range tests {
+		l := NewLexer("tabs", input, lexWords)
+		l.SetTabWidth(tc.width)
+		for _, want := range tc.cols {
+			tok := l.NextToken()
+			if col := l.Column(); col != want {
+				t.Errorf("width %d: %q at column %d, want %d", tc.width, tok.Val, col, want)
+			}
+		}
+	}
+}
+
+func TestUTF16Column(t *testing.T) {
+	// 😀 is outside the Basic Multilingual Plane: 4 bytes in UTF-8 and
+	// two UTF-16 code units. é and 漢 are within it: one unit each.
+	l := NewLexer("utf16", "a😀b\n😀😀c\té漢", lexWords)
+	tests := []struct {
+		offset, col int
+	}{
+		{0, 1},  // a
+		{1, 2},  // first 😀
+		{5, 4},  // b
+		{7, 1},  // 😀 starting the second line
+		{11, 3}, // second 😀
+		{15, 5}, // c
+		{16, 6}, // tab
+		{17, 7}, // é
+		{19, 8}, // 漢
+		{22, 9}, // end of input
+		{99, 9}, // clamped to the end
+	}
+	for _, tc := range tests {
+		if col := l.UTF16Column(tc.offset); col != tc.col {
+			t.Errorf("UTF16Column(%d) = %d, want %d", tc.offset, col, tc.col)
+		}
+	}
+}
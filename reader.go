@@ -0,0 +1,99 @@
+package lexer
+
+import (
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// readSize is the number of bytes requested from the reader each time
+// a reader-backed lexer needs more input.
+const readSize = 4096
+
+// maxEmptyReads is the number of consecutive reads returning no data
+// and no error tolerated before giving up with io.ErrNoProgress.
+const maxEmptyReads = 100
+
+// NewLexerReader creates a new scanner that reads its input
+// incrementally from r. Only the text from the start of the line
+// containing the pending token onward is kept in memory, so Input,
+// Start and Pos refer to that buffered window, while token positions
+// remain offsets within the whole input. A read error other than
+// io.EOF ends the input and is reported as a TokenError in place of
+// the lexer's EOF token; the token's LexError wraps the read error.
+func NewLexerReader(name string, r io.Reader, startState StateFn) *Lexer {
+	l := newLexer(name, startState)
+	l.r = r
+	l.fromReader = true
+	l.start()
+	return l
+}
+
+// ensure reads from the underlying reader, if any, until at least n
+// bytes are buffered past Pos or the input is exhausted. It reports
+// whether n bytes are available.
+func (l *Lexer) ensure(n int) bool {
+	for len(l.Input)-l.Pos < n {
+		if !l.fill() {
+			return false
+		}
+	}
+	return true
+}
+
+// fill discards text before the line containing the pending token (and
+// the last token returned by NextToken) and appends the next chunk read
+// from l.r to Input. It reports whether any input was added.
+func (l *Lexer) fill() bool {
+	if l.r == nil {
+		return false
+	}
+	buf := make([]byte, readSize)
+	n, err := l.r.Read(buf)
+	for empty := 1; n == 0 && err == nil; empty++ {
+		if empty == maxEmptyReads {
+			err = io.ErrNoProgress
+			break
+		}
+		n, err = l.r.Read(buf)
+	}
+	l.mu.Lock()
+	l.discard()
+	l.Input += string(buf[:n])
+	l.lineMu.Lock()
+	l.lineStarts = nil
+	l.lineMu.Unlock()
+	if err != nil {
+		if err != io.EOF {
+			l.readErr = err
+		}
+		l.r = nil
+	}
+	l.mu.Unlock()
+	return n > 0
+}
+
+// discard drops buffered text that precedes the start of the line
+// containing both Start and lastPos. The caller must hold l.mu.
+func (l *Lexer) discard() {
+	keep := l.Start
+	if i := l.lastPos - l.base; i < keep {
+		keep = i
+	}
+	starts := l.lineTable()
+	n := sort.SearchInts(starts, keep+1) - 1
+	// A trailing "\r" may yet be followed by the "\n" of a "\r\n".
+	if n > 0 && starts[n] == len(l.Input) && l.Input[starts[n]-1] == '\r' {
+		n--
+	}
+	if n <= 0 {
+		return
+	}
+	k := starts[n]
+	l.lines += n
+	l.runes += utf8.RuneCountInString(l.Input[:k])
+	l.base += k
+	l.Input = l.Input[k:]
+	l.Start -= k
+	l.Pos -= k
+}
@@ -0,0 +1,72 @@
+package lexer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReaderMatchesString(t *testing.T) {
+	// Reading one byte at a time makes the lexer refill, and discard
+	// consumed lines, between almost every rune.
+	input := strings.Repeat("héllo wörld\r\nfoo  bar\n\n\tbaz\r", 500)
+	want := NewLexer("string", input, lexWords)
+	got := NewLexerReader("reader", iotest.OneByteReader(strings.NewReader(input)), lexWords)
+	for {
+		w, g := want.NextToken(), got.NextToken()
+		if w.Typ != g.Typ || w.Val != g.Val || w.Pos != g.Pos || w.End != g.End {
+			t.Fatalf("reader token %v at %d-%d, want %v at %d-%d", g, g.Pos, g.End, w, w.Pos, w.End)
+		}
+		if wp, gp := want.Resolve(w), got.Resolve(g); wp != gp {
+			t.Fatalf("reader token %v at %+v, want %+v", g, gp, wp)
+		}
+		if wl, gl := want.LineNumber(), got.LineNumber(); wl != gl {
+			t.Fatalf("reader LineNumber after %v = %d, want %d", g, gl, wl)
+		}
+		if w.Typ == TokenEOF || w.Typ == TokenError {
+			break
+		}
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	errDisk := errors.New("disk on fire")
+	// lexUntilEOF is lexWords, except that it stops at the end of the
+	// input without emitting TokenEOF.
+	var lexUntilEOF StateFn
+	lexUntilEOF = func(l *Lexer) StateFn {
+		if l.SkipWhitespace(); l.Peek() == EOF {
+			return nil
+		}
+		l.AcceptRunFunc(func(r rune) bool { return r != ' ' && r != EOF })
+		l.Emit(tokWord)
+		return lexUntilEOF
+	}
+	for _, tc := range []struct {
+		name  string
+		state StateFn
+	}{
+		{"emit", lexWords},
+		{"return", lexUntilEOF},
+	} {
+		r := io.MultiReader(strings.NewReader("a b c"), iotest.ErrReader(errDisk))
+		l := NewLexerReader(tc.name, r, tc.state)
+		var vals []string
+		tok := l.NextToken()
+		for ; tok.Typ == tokWord; tok = l.NextToken() {
+			vals = append(vals, tok.Val)
+		}
+		if got := strings.Join(vals, " "); got != "a b c" {
+			t.Errorf("%s: words %q, want %q", tc.name, got, "a b c")
+		}
+		if e, ok := tok.LexError(); tok.Typ != TokenError || !ok || !errors.Is(e, errDisk) {
+			t.Errorf("%s: final token %v, want an error wrapping %v", tc.name, tok, errDisk)
+		}
+		<-l.Done()
+		if err := l.Err(); !errors.Is(err, errDisk) {
+			t.Errorf("%s: Err() = %v, want %v", tc.name, err, errDisk)
+		}
+	}
+}
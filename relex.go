@@ -0,0 +1,90 @@
+package lexer
+
+import "strings"
+
+// RelexRange applies an edit to the input, replacing Input[start:end]
+// with newText, and re-lexes only the region the edit affects, for
+// tools such as editors that must keep a token stream up to date as
+// the text changes. It returns the tokens of the affected region, with
+// positions in the edited input, which becomes the lexer's Input.
+//
+// Re-lexing begins at the start of the line containing start, in the
+// state lexing originally began in, and stops with the first token
+// that ends at or beyond the end of the line containing the inserted
+// text, or at the end of the input; a state function that goes on
+// lexing past that point is run no further than its return, and its
+// later tokens are discarded. Given the tokens of the input
+// before the edit, the returned tokens replace those starting within
+// the span of the returned tokens; tokens starting beyond it are kept,
+// with their positions moved by len(newText) - (end-start). Start and
+// end are byte offsets even for a lexer using WithRuneOffsets, but the
+// kept tokens of such a lexer move instead by the change in the number
+// of runes. This is sound when the start state is a valid state at the
+// start of every line and lexing from a line start does not depend on
+// earlier lines, which rules out, for example, comments spanning
+// lines; lexers for which it is not can re-lex from the start of the
+// input instead.
+//
+// Sources added by AppendSource are kept, those after the edit moving
+// with the text; text inserted by the edit belongs to the source in
+// which it begins.
+//
+// RelexRange ends any lexing in progress, and afterwards NextToken
+// returns TokenEOF. It panics for a reader-backed lexer, whose Input
+// holds only part of the text.
+func (l *Lexer) RelexRange(start, end int, newText string) []Token {
+	if l.fromReader {
+		panic("lexer: RelexRange on a reader-backed lexer")
+	}
+	input := l.Input[:start] + newText + l.Input[end:]
+	from := strings.LastIndexAny(input[:start], "\r\n") + 1
+	stop := len(input)
+	if i := strings.IndexAny(input[start+len(newText):], "\r\n"); i >= 0 {
+		stop = start + len(newText) + i
+	}
+	sources := l.sources
+	l.reset(l.name, input, l.initial)
+	l.sources = moveSources(sources, start, end, len(newText))
+	tokens := l.tokens
+	l.tokens = nil // collect emitted tokens in l.pending
+	l.Start, l.Pos = from, from
+	var toks []Token
+	for state := l.state; state != nil; {
+		state = l.step(state)
+		n := len(l.pending)
+		for i, t := range l.pending {
+			if l.endOffset(t) >= stop || t.Typ == TokenEOF || t.Typ == TokenError {
+				n, state = i+1, nil
+				break
+			}
+		}
+		toks = append(toks, l.pending[:n]...)
+		l.pending = l.pending[:0]
+	}
+	l.pending = nil
+	l.state = nil
+	l.tokens = tokens
+	if tokens != nil {
+		l.launch.Do(func() {}) // lexing is over; start no goroutine
+		close(tokens)
+	}
+	l.complete()
+	return toks
+}
+
+// moveSources returns sources adjusted for the replacement of the text
+// from start to end by n bytes. A source that began within the
+// replaced text begins after the inserted text instead.
+func moveSources(sources []source, start, end, n int) []source {
+	moved := make([]source, len(sources))
+	for i, src := range sources {
+		switch {
+		case src.start >= end:
+			src.start += n - (end - start)
+		case src.start > start:
+			src.start = start + n
+		}
+		moved[i] = src
+	}
+	return moved
+}
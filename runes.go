@@ -0,0 +1,33 @@
+package lexer
+
+import "unicode/utf8"
+
+// RuneOffset converts a byte offset in the input, such as the Pos of a
+// token, to the number of runes that precede it, for consumers that
+// count positions in runes. Offsets are clamped as for Position. Each
+// call counts the runes from the start of the buffered input, taking
+// time proportional to offset.
+func (l *Lexer) RuneOffset(offset int) int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.runes + utf8.RuneCountInString(l.Input[:l.index(offset)])
+}
+
+// A runeMark pairs a byte offset in the input with its rune offset.
+type runeMark struct {
+	off, runes int
+}
+
+// runeIndex returns the rune offset of the byte offset off for
+// WithRuneOffsets. Since tokens are mostly emitted in order, it counts
+// on from the last offset converted where it can. It must be called on
+// the goroutine running the state functions.
+func (l *Lexer) runeIndex(off int) int {
+	if off < l.runeAt.off || l.runeAt.off < l.base {
+		l.runeAt = runeMark{off: l.base, runes: l.runes}
+	}
+	i := l.index(off)
+	l.runeAt.runes += utf8.RuneCountInString(l.Input[l.runeAt.off-l.base : i])
+	l.runeAt.off = l.base + i
+	return l.runeAt.runes
+}
@@ -0,0 +1,351 @@
+package lexer
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SkipWhitespace consumes a run of white space and ignores it. White
+// space is as defined by WithWhitespace, by default Unicode white
+// space. As with Ignore, any text pending before the white space is
+// dropped.
+func (l *Lexer) SkipWhitespace() {
+	l.AcceptRunFunc(l.isSpace)
+	l.Ignore()
+}
+
+// isSpace reports whether r is white space, as defined by WithWhitespace.
+func (l *Lexer) isSpace(r rune) bool {
+	if l.space != nil {
+		return l.space(r)
+	}
+	return unicode.IsSpace(r)
+}
+
+// SkipLineComment consumes and ignores a comment running from prefix
+// to the end of the line, if the upcoming input begins with prefix.
+// The line break itself is left unconsumed. SkipLineComment reports
+// whether a comment was skipped.
+func (l *Lexer) SkipLineComment(prefix string) bool {
+	if !l.AcceptString(prefix) {
+		return false
+	}
+	l.AcceptUntil("\r\n")
+	l.Ignore()
+	return true
+}
+
+// AcceptLineContinuation consumes a backslash followed by a line
+// break, "\n" or "\r\n", and reports whether it did, so that a state
+// function can treat the two lines either side as one. A backslash not
+// followed by a line break is not consumed.
+func (l *Lexer) AcceptLineContinuation() bool {
+	return l.AcceptString("\\\n") || l.AcceptString("\\\r\n")
+}
+
+// SkipShebang consumes and ignores a "#!" interpreter line at the very
+// start of the input, as begins many scripts, and otherwise does
+// nothing. As with SkipLineComment, the line break is left unconsumed.
+func (l *Lexer) SkipShebang() {
+	if l.base+l.Pos == 0 {
+		l.SkipLineComment("#!")
+	}
+}
+
+// byteOrderMark is the UTF-8 encoding of U+FEFF.
+const byteOrderMark = "\uFEFF"
+
+// SkipBOM consumes and ignores a UTF-8 byte order mark at the very
+// start of the input, and otherwise does nothing. Token positions
+// remain byte offsets into the original input, so the first token
+// after a mark starts at offset 3. See WithBOMStripping.
+func (l *Lexer) SkipBOM() {
+	if l.base+l.Pos == 0 && l.AcceptString(byteOrderMark) {
+		l.Ignore()
+	}
+}
+
+// AcceptLine consumes the rest of the current line and returns the
+// text consumed. The line break that ends it, "\n", "\r\n" or a lone
+// "\r", is left unconsumed, so neither a trailing "\r" nor "\n" is
+// part of the result.
+func (l *Lexer) AcceptLine() string {
+	start := l.base + l.Pos
+	l.AcceptUntil("\r\n")
+	return l.Input[start-l.base : l.Pos]
+}
+
+// SkipLine consumes and ignores the rest of the current line together
+// with the line break that ends it, if any. As with Ignore, any text
+// pending before the line is dropped.
+func (l *Lexer) SkipLine() {
+	l.AcceptUntil("\r\n")
+	l.Accept("\r")
+	l.Accept("\n")
+	l.Ignore()
+}
+
+const decimalDigits = "0123456789"
+
+// ScanNumber consumes a decimal numeric literal: an optional sign, an
+// integer part, an optional fractional part and an optional exponent,
+// as in "42", "-3.5", ".5" or "6.02e23". It reports whether a literal
+// was consumed; if not, nothing is consumed. An exponent marker not
+// followed by digits is left unconsumed. With WithDigitSeparators,
+// single underscores may separate digits, as in "1_000". ScanNumber
+// does not emit a token.
+func (l *Lexer) ScanNumber() bool {
+	mark := l.Mark()
+	l.Accept("+-")
+	digits := l.scanDigits(decimalDigits)
+	if l.Accept(".") && l.scanDigits(decimalDigits) {
+		digits = true
+	}
+	if !digits {
+		l.Reset(mark)
+		return false
+	}
+	exp := l.Mark()
+	if l.Accept("eE") {
+		l.Accept("+-")
+		if !l.scanDigits(decimalDigits) {
+			l.Reset(exp)
+		}
+	}
+	return true
+}
+
+// ScanRadixNumber consumes an integer literal written in hexadecimal,
+// octal or binary with a "0x", "0o" or "0b" prefix (of either case), or
+// in decimal with no prefix, and returns its base. It reports whether a
+// literal was consumed; if not, nothing is consumed, including a prefix
+// with no digits after it, as in "0x". With WithDigitSeparators, single
+// underscores may separate digits, as in "0xFF_FF". ScanRadixNumber
+// does not emit a token.
+func (l *Lexer) ScanRadixNumber() (base int, ok bool) {
+	mark := l.Mark()
+	if l.Accept("0") {
+		var digits string
+		switch {
+		case l.Accept("xX"):
+			base, digits = 16, "0123456789abcdefABCDEF"
+		case l.Accept("oO"):
+			base, digits = 8, "01234567"
+		case l.Accept("bB"):
+			base, digits = 2, "01"
+		}
+		if base != 0 {
+			if !l.scanDigits(digits) {
+				l.Reset(mark)
+				return 0, false
+			}
+			return base, true
+		}
+		l.Reset(mark)
+	}
+	if !l.scanDigits(decimalDigits) {
+		return 0, false
+	}
+	return 10, true
+}
+
+// scanDigits consumes a run of runes from the valid set, allowing
+// single underscores between them when digit separators are enabled.
+// It reports whether any digits were consumed.
+func (l *Lexer) scanDigits(valid string) bool {
+	if !l.Accept(valid) {
+		return false
+	}
+	for {
+		l.AcceptRun(valid)
+		if !l.digitSep || !l.Accept("_") {
+			return true
+		}
+		if !l.Accept(valid) {
+			l.Backup()
+			return true
+		}
+	}
+}
+
+// IsIdentStart reports whether r may begin an identifier: a Unicode
+// letter or an underscore.
+func IsIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// IsIdentContinue reports whether r may follow the first rune of an
+// identifier: a Unicode letter, digit or an underscore.
+func IsIdentContinue(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// AtWordBoundary reports whether Pos is at the end of a word, that is,
+// whether the next rune is not one that may continue an identifier, so
+// that after AcceptString("in") a state function can tell the keyword
+// from the start of "input". The end of the input is a boundary.
+// WithIdentContinue sets the predicate used; by default it is
+// IsIdentContinue.
+func (l *Lexer) AtWordBoundary() bool {
+	r := l.Peek()
+	return r == EOF || !l.isIdentContinue(r)
+}
+
+// isIdentContinue reports whether r may continue an identifier, as
+// defined by WithIdentContinue.
+func (l *Lexer) isIdentContinue(r rune) bool {
+	if l.identCont != nil {
+		return l.identCont(r)
+	}
+	return IsIdentContinue(r)
+}
+
+// ScanIdentifier consumes one rune satisfying isStart followed by a
+// run of runes satisfying isContinue, and reports whether it did. If
+// the next rune does not satisfy isStart nothing is consumed.
+// IsIdentStart and IsIdentContinue provide conventional predicates.
+func (l *Lexer) ScanIdentifier(isStart, isContinue func(rune) bool) bool {
+	if !l.AcceptFunc(isStart) {
+		return false
+	}
+	l.AcceptRunFunc(isContinue)
+	return true
+}
+
+// maxEscape is the length of the longest escape sequence, \UXXXXXXXX.
+const maxEscape = 10
+
+// ScanQuotedString consumes a string literal delimited by quote,
+// including the opening and closing quotes, and returns its value with
+// backslash escapes decoded. The escapes are those of Go string
+// literals, such as \n, \\, \" and \u00e9. If the next rune is not
+// quote, nothing is consumed. A missing closing quote or an invalid
+// escape is reported as a LexError; the input consumed up to that
+// point is not restored.
+func (l *Lexer) ScanQuotedString(quote rune) (string, error) {
+	open := l.base + l.Pos
+	if !l.Accept(string(quote)) {
+		return "", l.errorAt(open, fmt.Sprintf("expected %q", quote))
+	}
+	var q byte
+	if quote < utf8.RuneSelf {
+		q = byte(quote)
+	}
+	var b strings.Builder
+	for {
+		switch r := l.Next(); r {
+		case EOF:
+			return "", l.errorOf(ErrUnterminatedString, open, "unterminated string")
+		case quote:
+			return b.String(), nil
+		case '\\':
+			l.Backup()
+			l.ensure(maxEscape)
+			value, multibyte, tail, err := strconv.UnquoteChar(l.Input[l.Pos:], q)
+			if err != nil {
+				return "", l.errorOf(ErrInvalidEscape, l.base+l.Pos, "invalid escape sequence")
+			}
+			for end := len(l.Input) - len(tail); l.Pos < end; {
+				if l.Next() == EOF {
+					return "", l.errorOf(ErrUnterminatedString, open, "unterminated string")
+				}
+			}
+			if multibyte || value < utf8.RuneSelf {
+				b.WriteRune(value)
+			} else {
+				b.WriteByte(byte(value))
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+// SkipNestedComment consumes and ignores a block comment delimited by
+// open and close, in which comments may nest, as in "/* a /* b */ */".
+// Where open and close both match, the longer is preferred. If the
+// upcoming input does not begin with open, nothing is consumed and an
+// error is returned. An error is also returned if the input ends before
+// the outermost comment is closed.
+func (l *Lexer) SkipNestedComment(open, close string) error {
+	start := l.base + l.Pos
+	if !l.AcceptString(open) {
+		return l.errorAt(start, fmt.Sprintf("expected %q", open))
+	}
+	for depth := 1; depth > 0; {
+		l.ensure(max(len(open), len(close)))
+		rest := l.Input[l.Pos:]
+		isOpen := strings.HasPrefix(rest, open)
+		isClose := strings.HasPrefix(rest, close)
+		switch {
+		case isOpen && (!isClose || len(open) > len(close)):
+			if !l.AcceptString(open) {
+				return l.errorOf(ErrUnterminatedComment, start, "unterminated comment")
+			}
+			depth++
+		case isClose:
+			if !l.AcceptString(close) {
+				return l.errorOf(ErrUnterminatedComment, start, "unterminated comment")
+			}
+			depth--
+		case l.Next() == EOF:
+			return l.errorOf(ErrUnterminatedComment, start, "unterminated comment")
+		}
+	}
+	l.Ignore()
+	return nil
+}
+
+// ScanBalanced consumes a group delimited by open and close, in which
+// groups may nest, as in "(a, (b), c)", and returns the text between
+// the outermost delimiters. Delimiters inside a string literal opened
+// by any of quotes are disregarded; within such a literal a backslash
+// escapes the rune after it. If the next rune is not open, nothing is
+// consumed and an error is returned. An error is also returned if the
+// input ends before the group or a literal in it is closed; the input
+// consumed up to that point is not restored.
+func (l *Lexer) ScanBalanced(open, close rune, quotes ...rune) (string, error) {
+	start := l.base + l.Pos
+	if !l.Accept(string(open)) {
+		return "", l.errorAt(start, fmt.Sprintf("expected %q", open))
+	}
+	inner := l.base + l.Pos
+	for depth := 1; ; {
+		r := l.Next()
+		switch {
+		case r == EOF:
+			return "", l.errorOf(ErrUnexpectedEOF, start, fmt.Sprintf("unclosed %q", open))
+		case r == close:
+			if depth--; depth == 0 {
+				return l.Input[inner-l.base : l.Pos-l.Width], nil
+			}
+		case r == open:
+			depth++
+		case slices.Contains(quotes, r):
+			quote := l.base + l.Pos - l.Width
+			if !l.skipQuoted(r) {
+				return "", l.errorOf(ErrUnterminatedString, quote, "unterminated string")
+			}
+		}
+	}
+}
+
+// skipQuoted consumes the rest of a string literal closed by quote, in
+// which a backslash escapes the rune after it. It reports whether the
+// closing quote was found.
+func (l *Lexer) skipQuoted(quote rune) bool {
+	for {
+		switch l.Next() {
+		case EOF:
+			return false
+		case quote:
+			return true
+		case '\\':
+			l.Next()
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package lexer
+
+// TokenSource is implemented by anything that yields a stream of tokens,
+// such as a *Lexer or one of the wrappers returned by its Filtered and
+// Map methods. Sources may be layered, each one reading from the next.
+type TokenSource interface {
+	NextToken() Token
+}
+
+// filter is a TokenSource that drops tokens of chosen types.
+type filter struct {
+	src  TokenSource
+	skip map[TokenType]bool
+}
+
+// Filtered returns a TokenSource that reads tokens from l, silently
+// dropping any whose type is among skip. TokenEOF and TokenError are
+// always passed through, so the stream still ends and reports errors as
+// l's would. The tokens returned are unchanged, positions included.
+func (l *Lexer) Filtered(skip ...TokenType) TokenSource {
+	return Filter(l, skip...)
+}
+
+// Filter is like Lexer.Filtered, but reads from any TokenSource.
+func Filter(src TokenSource, skip ...TokenType) TokenSource {
+	f := &filter{src: src, skip: make(map[TokenType]bool, len(skip))}
+	for _, t := range skip {
+		if t != TokenEOF && t != TokenError {
+			f.skip[t] = true
+		}
+	}
+	return f
+}
+
+// NextToken returns the next token from the underlying source whose
+// type is not skipped.
+func (f *filter) NextToken() Token {
+	for {
+		t := f.src.NextToken()
+		if !f.skip[t.Typ] {
+			return t
+		}
+	}
+}
+
+// mapper is a TokenSource that transforms each token it passes on.
+type mapper struct {
+	src TokenSource
+	f   func(Token) Token
+}
+
+// Map returns a TokenSource that reads tokens from l and returns f
+// applied to each, letting a single function reclassify identifiers as
+// keywords, say, or normalize values. f sees every token, including
+// TokenEOF and TokenError, and should return those unchanged. Map and
+// Filtered compose: l.Filtered(SPACE) can be passed to the package-level
+// Map, and so on.
+func (l *Lexer) Map(f func(Token) Token) TokenSource {
+	return Map(l, f)
+}
+
+// Map is like Lexer.Map, but reads from any TokenSource.
+func Map(src TokenSource, f func(Token) Token) TokenSource {
+	return &mapper{src: src, f: f}
+}
+
+// NextToken returns the next token from the underlying source, after
+// transforming it.
+func (m *mapper) NextToken() Token {
+	return m.f(m.src.NextToken())
+}
@@ -0,0 +1,70 @@
+package lexer
+
+import "sort"
+
+// A source records where text added by AppendSource begins in Input.
+type source struct {
+	name  string
+	start int
+}
+
+// AppendSource appends text to the input as coming from the source
+// named name, such as a file pulled in by an include directive, so
+// that input assembled from several sources can be lexed as one while
+// positions remain traceable to their origin. Token positions remain
+// offsets in the combined input; SourceAt and SourcePosition map them
+// back, and errors are reported against the source containing them.
+// Text given to the constructor belongs to the source named by the
+// lexer's name. AppendSource must be called before the first call to
+// NextToken, and panics for a reader-backed lexer.
+func (l *Lexer) AppendSource(name, text string) {
+	if l.fromReader {
+		panic("lexer: AppendSource on a reader-backed lexer")
+	}
+	l.sources = append(l.sources, source{name: name, start: len(l.Input)})
+	l.Input += text
+	l.lineMu.Lock()
+	l.lineStarts = nil
+	l.lineMu.Unlock()
+}
+
+// SourceAt returns the name of the source containing offset in the
+// combined input.
+func (l *Lexer) SourceAt(offset int) string {
+	name, _ := l.sourceAt(offset)
+	return name
+}
+
+// SourcePosition returns the name of the source containing offset and
+// its 1-based line and column within that source, counted as for
+// Position.
+func (l *Lexer) SourcePosition(offset int) (name string, line, col int) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.sourcePosition(offset)
+}
+
+// sourcePosition is SourcePosition without locking; see position.
+func (l *Lexer) sourcePosition(offset int) (name string, line, col int) {
+	name, start := l.sourceAt(offset)
+	line, col = l.position(offset)
+	if start > 0 {
+		startLine, startCol := l.position(start)
+		if line == startLine {
+			col -= startCol - 1
+		}
+		line -= startLine - 1
+	}
+	return name, line, col
+}
+
+// sourceAt returns the name of the source containing offset and the
+// offset at which it begins.
+func (l *Lexer) sourceAt(offset int) (name string, start int) {
+	i := sort.Search(len(l.sources), func(i int) bool { return l.sources[i].start > offset })
+	if i == 0 {
+		return l.name, 0
+	}
+	s := l.sources[i-1]
+	return s.name, s.start
+}
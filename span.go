@@ -0,0 +1,53 @@
+package lexer
+
+import "sort"
+
+// Span is a range of byte offsets in the input, from Pos up to but not
+// including End.
+type Span struct {
+	Pos, End int
+}
+
+// CheckCoverage reports how well the source spans [Pos, End) of toks
+// cover an input of size bytes. It returns the spans of input covered
+// by no token, such as text dropped by Ignore, and the spans covered
+// by more than one token. Both are empty for a lossless token stream,
+// one whose source text concatenates to the whole input. Zero-width
+// tokens such as TokenEOF are disregarded.
+func CheckCoverage(toks []Token, size int) (gaps, overlaps []Span) {
+	sorted := make([]Token, 0, len(toks))
+	for _, t := range toks {
+		if t.End > t.Pos {
+			sorted = append(sorted, t)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Pos < sorted[j].Pos })
+	covered := 0
+	for _, t := range sorted {
+		if t.Pos > covered {
+			gaps = append(gaps, Span{covered, t.Pos})
+		} else if t.Pos < covered {
+			overlaps = append(overlaps, Span{t.Pos, min(t.End, covered)})
+		}
+		covered = max(covered, t.End)
+	}
+	if covered < size {
+		gaps = append(gaps, Span{covered, size})
+	}
+	return gaps, overlaps
+}
+
+// TokenAt returns the token among toks whose source span [Pos, End)
+// contains offset, reporting whether there is one. toks must be sorted
+// by Pos, as returned by All, and must not overlap; zero-width tokens
+// contain no offset and are passed over. Offsets in text covered by no
+// token, such as ignored white space, report false.
+func TokenAt(toks []Token, offset int) (Token, bool) {
+	i := sort.Search(len(toks), func(i int) bool { return toks[i].Pos > offset })
+	for i--; i >= 0 && toks[i].End <= toks[i].Pos; i-- {
+	}
+	if i >= 0 && offset < toks[i].End {
+		return toks[i], true
+	}
+	return Token{}, false
+}
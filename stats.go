@@ -0,0 +1,34 @@
+package lexer
+
+import "sync/atomic"
+
+// Stats holds running totals describing the work a lexer has done.
+type Stats struct {
+	TokensEmitted int // tokens emitted, including error tokens
+	BytesConsumed int // bytes of input emitted or ignored
+	Errors        int // errors reported by Errorf, EmitErrorf and the lexer itself
+}
+
+// counters holds the totals reported by Stats. They are written by the
+// goroutine running the state functions and may be read by any.
+type counters struct {
+	tokens, consumed, errors atomic.Int64
+}
+
+// reset zeroes the counters.
+func (c *counters) reset() {
+	c.tokens.Store(0)
+	c.consumed.Store(0)
+	c.errors.Store(0)
+}
+
+// Stats returns the lexer's totals so far. Since the state functions
+// may run ahead of the client, tokens emitted need not yet have been
+// returned by NextToken. Stats may be called from any goroutine.
+func (l *Lexer) Stats() Stats {
+	return Stats{
+		TokensEmitted: int(l.stats.tokens.Load()),
+		BytesConsumed: int(l.stats.consumed.Load()),
+		Errors:        int(l.stats.errors.Load()),
+	}
+}